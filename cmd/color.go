@@ -0,0 +1,178 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-isatty"
+	"github.com/muesli/termenv"
+	"github.com/spf13/viper"
+)
+
+// Values of --color
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// Whether the output is colored, see loadColorMode
+var colorOutput = true
+
+// Colors the terminal supports, Ascii for none
+var profile = termenv.ANSI
+
+// Colors the themes leave out
+const (
+	// Deleted entries
+	ghostColor = "244"
+	// Last commit messages
+	subjectColor = "244"
+	branchColor  = "241"
+)
+
+// Whether the waiting line is shown
+var showProgress = true
+
+// Returns true when the standard output is a terminal
+func stdoutIsTerminal() bool {
+	fd := os.Stdout.Fd()
+
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
+
+// Returns whether the output is colored in the mode
+// 'mode', accepting the synonyms of GNU ls
+//
+// In auto mode, $NO_COLOR disables colors, then
+// $CLICOLOR_FORCE enables them and CLICOLOR=0 disables
+// them, otherwise the output is colored on terminals
+func colorsEnabled(mode string) (bool, error) {
+	switch mode {
+	case colorAlways, "yes", "force":
+		return true, nil
+	case colorNever, "no", "none":
+		return false, nil
+	case colorAuto, "tty", "if-tty", "":
+	default:
+		return false, fmt.Errorf("invalid color mode %q, expected auto, always or never", mode)
+	}
+
+	if os.Getenv("NO_COLOR") != "" {
+		return false, nil
+	}
+
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true, nil
+	}
+
+	if os.Getenv("CLICOLOR") == "0" {
+		return false, nil
+	}
+
+	return stdoutIsTerminal(), nil
+}
+
+// Reads --color, or the "color" key of the config file
+// The waiting line is only shown on terminals, with colors
+func loadColorMode() error {
+	enabled, err := colorsEnabled(viper.GetString("color"))
+	if err != nil {
+		return err
+	}
+
+	colorOutput = enabled
+	showProgress = enabled && stdoutIsTerminal()
+
+	profile = termenv.Ascii
+	if enabled {
+		// Colors forced into a pipe follow $TERM and $COLORTERM
+		// too, the 16 ANSI colors are used for unknown terminals
+		profile = termenv.NewOutput(os.Stdout, termenv.WithTTY(true)).ColorProfile()
+		if profile == termenv.Ascii {
+			profile = termenv.ANSI
+		}
+	}
+
+	return nil
+}
+
+// Returns a style of the color 'color', a hex color ("#ff8700")
+// or an ANSI color index ("208"), converted to the colors
+// the terminal supports
+func colored(color string) termenv.Style {
+	if profile == termenv.ANSI {
+		return profile.String().Foreground(ansiColor(color))
+	}
+
+	return profile.String().Foreground(profile.Color(color))
+}
+
+// Converts a color to one of the 16 ANSI colors, grays going to
+// the gray of the closest lightness that shows on the background
+// of the terminal, instead of the closest color
+func ansiColor(color string) termenv.Color {
+	c := termenv.TrueColor.Color(color)
+	if _, ok := c.(termenv.ANSIColor); ok || c == nil {
+		return c
+	}
+
+	_, chroma, lightness := termenv.ConvertToRGB(c).Hcl()
+	if chroma > 0.05 {
+		return termenv.ANSI.Convert(c)
+	}
+
+	// Black, bright black, white and bright white
+	gray := termenv.ANSIColor(15)
+	switch {
+	case lightness < 0.25:
+		gray = 0
+	case lightness < 0.55:
+		gray = 8
+	case lightness < 0.85:
+		gray = 7
+	}
+
+	if gray == 0 && darkBackground() {
+		gray = 8
+	}
+	if gray == 15 && !darkBackground() {
+		gray = 7
+	}
+
+	return gray
+}
+
+// Returns 'text' in the color 'color'
+func paint(color string, text string) string {
+	return colored(color).Styled(text)
+}
+
+// Prints the waiting line, unless the output is plain
+func printWaiting() {
+	if showProgress {
+		fmt.Print("Reading directory…")
+	}
+}
+
+// Clears the waiting line
+func clearWaiting() {
+	if showProgress {
+		fmt.Print("\r                  \r")
+	}
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import "testing"
+
+func TestColorsEnabled(t *testing.T) {
+	for _, tt := range []struct {
+		mode  string
+		env   map[string]string
+		want  bool
+		error bool
+	}{
+		{mode: "always", want: true},
+		{mode: "force", want: true},
+		{mode: "always", env: map[string]string{"NO_COLOR": "1"}, want: true},
+		{mode: "never", want: false},
+		{mode: "none", env: map[string]string{"CLICOLOR_FORCE": "1"}, want: false},
+		{mode: "sometimes", error: true},
+
+		// The output of go test is not a terminal
+		{mode: "auto", want: false},
+		{mode: "", want: false},
+		{mode: "auto", env: map[string]string{"CLICOLOR_FORCE": "1"}, want: true},
+		{mode: "tty", env: map[string]string{"CLICOLOR_FORCE": "0"}, want: false},
+		{mode: "auto", env: map[string]string{"CLICOLOR_FORCE": "1", "NO_COLOR": "1"}, want: false},
+		{mode: "auto", env: map[string]string{"CLICOLOR_FORCE": "1", "CLICOLOR": "0"}, want: true},
+		{mode: "if-tty", env: map[string]string{"CLICOLOR": "1"}, want: false},
+	} {
+		for _, name := range []string{"NO_COLOR", "CLICOLOR", "CLICOLOR_FORCE"} {
+			t.Setenv(name, tt.env[name])
+		}
+
+		got, err := colorsEnabled(tt.mode)
+		if tt.error {
+			if err == nil {
+				t.Errorf("colorsEnabled(%q) = %v, want an error", tt.mode, got)
+			}
+			continue
+		}
+
+		if err != nil || got != tt.want {
+			t.Errorf("colorsEnabled(%q) with %v = %v, %v, want %v", tt.mode, tt.env, got, err, tt.want)
+		}
+	}
+}
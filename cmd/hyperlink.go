@@ -0,0 +1,170 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gaelph/k/internal/git"
+	"github.com/spf13/viper"
+)
+
+// Values of --hyperlink
+const (
+	hyperlinkAuto   = "auto"
+	hyperlinkAlways = "always"
+	hyperlinkNever  = "never"
+)
+
+// Link of file names when no template is set
+const defaultFileLink = "file://{host}{path}"
+
+// Whether file names are links, see loadHyperlinks
+var hyperlinks = false
+
+// Templates of the links of files, and of
+// repositories, empty to link them like files
+var fileLink, repoLink string
+
+// Host name in file:// links
+var hostname string
+
+// Reads --hyperlink, or the "hyperlink" key of the config file, and
+// the link templates of the "hyperlinks.file" and "hyperlinks.repo"
+// keys. Like `ls --hyperlink`, auto only links on terminals
+func loadHyperlinks() error {
+	switch viper.GetString("hyperlink") {
+	case hyperlinkAlways, "yes", "force":
+		hyperlinks = true
+	case hyperlinkNever, "no", "none":
+		hyperlinks = false
+	case hyperlinkAuto, "tty", "if-tty", "":
+		hyperlinks = stdoutIsTerminal()
+	default:
+		return fmt.Errorf("invalid hyperlink mode %q, expected auto, always or never", viper.GetString("hyperlink"))
+	}
+
+	fileLink = viper.GetString("hyperlinks.file")
+	if fileLink == "" {
+		fileLink = defaultFileLink
+	}
+	repoLink = viper.GetString("hyperlinks.repo")
+
+	hostname, _ = os.Hostname()
+
+	return nil
+}
+
+// Returns 'text' as an OSC 8 link to the file 'fd', with the
+// template of repositories when 'repo' isn't nil
+// Entries that are not on the disk are not linked
+func hyperlink(fd FileDscr, repo *git.Repo, text string) string {
+	if !hyperlinks || fd.isGhost() || fd.revEntry != nil {
+		return text
+	}
+
+	link := ""
+	if repo != nil && repoLink != "" {
+		link = expandLink(repoLink, fd, repo)
+	}
+
+	// Repositories without a remote are linked like files
+	if link == "" {
+		link = expandLink(fileLink, fd, repo)
+	}
+	if link == "" {
+		return text
+	}
+
+	return "\x1b]8;;" + link + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+// Replaces the placeholders of a link template:
+//
+//	{host}    host name
+//	{path}    absolute path of the file, escaped
+//	{name}    name of the file, escaped
+//	{remote}  web page of the remote of the repository
+//
+// Returns an empty link when the template uses {remote}
+// and 'fd' is not a repository ('repo' is nil), or has no remote
+func expandLink(template string, fd FileDscr, repo *git.Repo) string {
+	remote := ""
+	if strings.Contains(template, "{remote}") {
+		if repo != nil {
+			remote = remoteWebURL(fd.fullpath)
+		}
+		if remote == "" {
+			return ""
+		}
+	}
+
+	return strings.NewReplacer(
+		"{host}", hostname,
+		"{path}", (&url.URL{Path: fd.fullpath}).EscapedPath(),
+		"{name}", url.PathEscape(fd.name),
+		"{remote}", remote,
+	).Replace(template)
+}
+
+// Web pages of the remotes of the repositories,
+// by path, see remoteWebURL
+var remotes = make(map[string]string)
+
+// Returns the web page of the remote of the repository at
+// 'dir', asking git once per repository
+func remoteWebURL(dir string) string {
+	if remote, ok := remotes[dir]; ok {
+		return remote
+	}
+
+	remote, _ := git.RemoteURL(dir)
+	remotes[dir] = webURL(remote)
+
+	return remotes[dir]
+}
+
+// scp-like remote URLs: "git@github.com:gaelph/k.git"
+var scpURL = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// Returns the web page of a repository from the URL of one of its
+// remotes (https://, ssh://, git:// or scp-like), the way code
+// hosting sites lay them out
+// Empty for local remotes
+func webURL(remote string) string {
+	host, repoPath := "", ""
+
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		switch u.Scheme {
+		case "http", "https", "ssh", "git", "git+ssh", "ssh+git":
+			host, repoPath = u.Hostname(), u.Path
+		}
+	} else if m := scpURL.FindStringSubmatch(remote); m != nil {
+		host, repoPath = m[1], m[2]
+	}
+
+	if host == "" {
+		return ""
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+
+	return "https://" + host + "/" + repoPath
+}
@@ -0,0 +1,187 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gaelph/k/internal/git"
+	"github.com/gaelph/k/internal/tabwriter"
+)
+
+// repoRow is a line of the repository dashboard
+type repoRow struct {
+	// Path relative to the listed directory
+	name   string
+	repo   *git.Repo
+	counts git.StatusCounts
+	// nil for repositories without commits
+	last *git.Commit
+}
+
+// Returns the repositories below 'cwd', up to 'depth' levels
+// deep, without looking for repositories inside of repositories
+func findRepositories(cwd string, depth int) []string {
+	repos := []string{}
+	showHidden := *listAlmostAll || *listAll
+
+	var walk func(rel string, level int)
+	walk = func(rel string, level int) {
+		files, err := os.ReadDir(path.Join(cwd, rel))
+		if err != nil {
+			return
+		}
+
+		for _, file := range files {
+			if !file.IsDir() || (!showHidden && strings.HasPrefix(file.Name(), ".")) {
+				continue
+			}
+
+			name := path.Join(rel, file.Name())
+
+			if git.IsRepository(path.Join(cwd, name)) {
+				repos = append(repos, name)
+			} else if level < depth {
+				walk(name, level+1)
+			}
+		}
+	}
+
+	walk("", 1)
+
+	return repos
+}
+
+// Collects what the dashboard shows for a repository
+func loadRepoRow(cwd string, name string) repoRow {
+	dir := path.Join(cwd, name)
+	row := repoRow{name: name, repo: git.GetRepo(dir)}
+
+	// The dashboard doesn't count ignored files
+	if statuses, err := git.LoadStatuses(dir, false); err == nil {
+		row.counts = statuses.Counts()
+	}
+
+	// Stops at the first commit
+	if history, err := git.LoadHistory(dir, "", nil); err == nil {
+		row.last = history.LastCommit(dir)
+	}
+
+	return row
+}
+
+// Collects the dashboard rows of 'names', checking
+// several repositories at once
+func loadRepoRows(cwd string, names []string) []repoRow {
+	rows := make([]repoRow, len(names))
+
+	git.Parallel(len(names), func(i int) {
+		rows[i] = loadRepoRow(cwd, names[i])
+	})
+
+	return rows
+}
+
+// Sorts the dashboard by name, or by last commit with -t
+func sortRepoRows(rows []repoRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		less := rows[i].name < rows[j].name
+
+		if *sortModTime {
+			var timeI, timeJ int64
+			if rows[i].last != nil {
+				timeI = rows[i].last.Time.Unix()
+			}
+			if rows[j].last != nil {
+				timeJ = rows[j].last.Time.Unix()
+			}
+
+			less = sortFn(timeI, timeJ, false)
+		}
+
+		if *reverseSort {
+			return !less
+		}
+
+		return less
+	})
+}
+
+// Formats a count of changed paths with the dashboard sign
+// and the color of their state, empty when there are none
+func formatCount(count int, state string) string {
+	if count == 0 {
+		return ""
+	}
+
+	return paint(palette().VCS[state], fmt.Sprint(theme.DashboardSigns[state], count))
+}
+
+// Prints a line of the dashboard to a tabwriter
+func printRepoRow(writer *tabwriter.Writer, row repoRow) {
+	status := "--"
+	if row.repo != nil {
+		status = row.repo.Status
+	}
+
+	age, subject := "", ""
+	if row.last != nil {
+		age = paint(timeColor(row.last.Time), relativeTime(row.last.Time))
+		subject = " " + paint(subjectColor, row.last.Subject)
+	}
+
+	elemts := []string{
+		formatCount(row.counts.Conflicted, "conflict"),
+		formatCount(row.counts.Staged, "staged"),
+		formatCount(row.counts.Unstaged, "modified"),
+		formatCount(row.counts.Untracked, "untracked"),
+		age,
+		formatVCSStatus(status),
+		" " + row.name + " " + formatRepo(row.repo) + subject,
+	}
+
+	fmt.Fprintln(writer, strings.Join(elemts, "\t"))
+}
+
+// Prints the repository dashboard: one line per repository
+// found below 'cwd', with its branch, pending changes,
+// stashes and last commit
+func printRepos(cwd string, depth int) {
+	rows := loadRepoRows(cwd, findRepositories(cwd, depth))
+	sortRepoRows(rows)
+
+	writer := tabwriter.NewWriter(
+		os.Stdout,
+		0,
+		4,
+		1,
+		' ',
+		tabwriter.AlignRight,
+	)
+
+	for _, row := range rows {
+		printRepoRow(writer, row)
+	}
+
+	clearWaiting()
+
+	fmt.Printf(" repositories %d\n", len(rows))
+	writer.Flush()
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gaelph/k/internal/git"
+	"github.com/gaelph/k/internal/tabwriter"
+	"github.com/muesli/termenv"
+)
+
+func TestPrintRepoRowWithoutColors(t *testing.T) {
+	defer func(p termenv.Profile) { profile = p }(profile)
+	profile = termenv.Ascii
+
+	for _, name := range []string{"default", "mono"} {
+		defer func(t Theme) { theme = t }(theme)
+		theme = builtinThemes[name].clone()
+
+		var b bytes.Buffer
+		writer := tabwriter.NewWriter(&b, 0, 4, 1, ' ', tabwriter.AlignRight)
+
+		printRepoRow(writer, repoRow{
+			name:   "repo",
+			counts: git.StatusCounts{Conflicted: 1, Staged: 2, Unstaged: 2, Untracked: 3},
+		})
+		writer.Flush()
+
+		fields := strings.Fields(b.String())
+		want := []string{"✖1", "+2", "!2", "?3"}
+
+		if len(fields) < len(want) || strings.Join(fields[:len(want)], " ") != strings.Join(want, " ") {
+			t.Errorf("%s theme: row %q, want it to start with %q", name, b.String(), strings.Join(want, " "))
+		}
+	}
+}
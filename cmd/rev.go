@@ -0,0 +1,161 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/gaelph/k/internal/git"
+	"github.com/spf13/cobra"
+)
+
+// Flags about the state of the work tree, which
+// has nothing to do with the entries of a revision
+var workTreeFlags = []string{"modified", "staged", "untracked", "conflicted", "git-ignore", "dim-ignored", "diff-stat"}
+
+// Returns an error when --rev is set along with one of
+// the workTreeFlags, rather than silently ignoring it
+func checkRevFlags(cmd *cobra.Command) error {
+	for _, name := range workTreeFlags {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("--%s can't be used with --rev: the entries of a revision have no git status", name)
+		}
+	}
+
+	return nil
+}
+
+// revFileInfo describes an entry of a directory
+// at a given revision as an os.FileInfo
+type revFileInfo struct {
+	entry   *git.RevEntry
+	modTime time.Time
+}
+
+func (fi revFileInfo) Name() string       { return fi.entry.Name }
+func (fi revFileInfo) Size() int64        { return fi.entry.Size }
+func (fi revFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi revFileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+func (fi revFileInfo) Sys() any           { return nil }
+
+// Maps the modes recorded by git to file modes
+func (fi revFileInfo) Mode() os.FileMode {
+	switch fi.entry.Mode {
+	case 0040000, 0160000:
+		return os.ModeDir | 0755
+	case 0120000:
+		return os.ModeSymlink | 0777
+	case 0100755:
+		return 0755
+	}
+
+	return 0644
+}
+
+// Returns the descriptors of the entries of 'cwd' as of
+// the revision 'rev', with the history of the revision
+// when last commits are shown
+//
+// Entries are dated with the revision, or with the last
+// commit touching them with --time=commit
+func getRevDescriptors(cwd string, rev string) ([]FileDscr, *git.History, error) {
+	revision, err := git.LoadRevision(cwd, rev)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commitTime := timeFlags.source == timeCommit
+
+	var history *git.History
+	if *gitLog || commitTime {
+		names := []string{}
+		for _, entry := range revision.Entries {
+			names = append(names, entry.Name)
+		}
+
+		if history, err = git.LoadHistory(cwd, revision.Commit, names); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	descriptors := make([]FileDscr, 0)
+
+	for i := range revision.Entries {
+		entry := &revision.Entries[i]
+		fullpath := path.Join(cwd, entry.Name)
+
+		info := revFileInfo{entry, revision.Time}
+		if commitTime {
+			if c := history.LastCommit(fullpath); c != nil {
+				info.modTime = c.Time
+			}
+		}
+
+		if shouldPrint(entry.Name, info.IsDir()) {
+			descriptors = append(descriptors, FileDscr{
+				name:     entry.Name,
+				fullpath: fullpath,
+				fileInfo: info,
+				revEntry: entry,
+			})
+		}
+	}
+
+	// In the order of os.ReadDir, git sorts
+	// directories as if they ended with "/"
+	sort.SliceStable(descriptors, func(i, j int) bool {
+		return descriptors[i].name < descriptors[j].name
+	})
+
+	if !*gitLog {
+		history = nil
+	}
+
+	return sortDescriptors(descriptors, nil), history, nil
+}
+
+// Returns the repository shown next to a
+// submodule, checked out at its recorded commit
+func revSubmodule(fd FileDscr) *git.Repo {
+	if fd.revEntry.Mode != 0160000 {
+		return nil
+	}
+
+	return &git.Repo{
+		Kind:             git.RepoSubmodule,
+		AtRecordedCommit: true,
+		Status:           "DG",
+		Branch:           fd.revEntry.Oid[:7],
+		Detached:         true,
+	}
+}
+
+// Columns of an entry at a revision: git only
+// records whether files are executable
+func revElements(fd FileDscr) []string {
+	return []string{
+		fd.fileInfo.Mode().String(),
+		"-",
+		"-",
+		"-",
+		formatSize(fd.fileInfo.Size()),
+		formatTime(fd.fileInfo.ModTime()),
+	}
+}
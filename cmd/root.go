@@ -23,17 +23,14 @@ import (
 	"strings"
 	"time"
 
-	"github.com/muesli/termenv"
-
 	"github.com/gaelph/k/internal/git"
+	"github.com/gaelph/k/internal/lscolors"
 	"github.com/gaelph/k/internal/numfmt"
 	. "github.com/gaelph/k/internal/stat"
 	"github.com/gaelph/k/internal/tabwriter"
 
 	"github.com/spf13/cobra"
 
-	"github.com/logrusorgru/aurora/v3"
-	. "github.com/logrusorgru/aurora/v3"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
 )
@@ -43,125 +40,112 @@ var cfgFile string
 type FileDscr struct {
 	name     string
 	fullpath string
+	// nil for ghosts: tracked entries deleted
+	// from the work tree
 	fileInfo os.FileInfo
 	stat     PlatformStat
+	// Ghosts only, the deleted entry was a directory
+	ghostDir bool
+	// Set when listing a revision, 'fileInfo'
+	// is built from it and 'stat' is empty
+	revEntry *git.RevEntry
 }
 
-var darkSize = []uint8{
-	46,
-	82,
-	118,
-	154,
-	190,
-	226,
-	220,
-	214,
-	208,
-	202,
-	196, // default
-}
-
-var lightSize = []uint8{
-	34,
-	70,
-	106,
-	142,
-	178,
-	214,
-	208,
-	202,
-	196,
-	160,
-	184, // default
+// Returns true if the entry was deleted from the work tree
+func (fd FileDscr) isGhost() bool {
+	return fd.fileInfo == nil
 }
 
-// Return the color for a file size
-func SizeToColor(size int64) uint8 {
-	colors := lightSize
-	isDark := termenv.DefaultOutput().HasDarkBackground()
-	if isDark {
-		colors = darkSize
+func (fd FileDscr) isDir() bool {
+	if fd.isGhost() {
+		return fd.ghostDir
 	}
 
-	// 1kB
-	if size <= 1024 {
-		return colors[0]
-	}
-	// 2kB
-	if size <= 2048 {
-		return colors[1]
-	}
-	// 3kB
-	if size <= 3072 {
-		return colors[2]
-	}
-	// 5kB
-	if size <= 5120 {
-		return colors[3]
-	}
-	// 10kB
-	if size <= 10240 {
-		return colors[4]
-	}
-	// 20kB
-	if size <= 20480 {
-		return colors[5]
+	return fd.fileInfo.IsDir()
+}
+
+// Returns the size of an entry, 0 for ghosts
+func (fd FileDscr) size() int64 {
+	if fd.isGhost() {
+		return 0
 	}
-	// 40kB
-	if size <= 40960 {
-		return colors[6]
+
+	return fd.fileInfo.Size()
+}
+
+// Returns the modification, access and change times
+// of an entry, the epoch for ghosts, and the
+// modification time for entries of a revision
+func (fd FileDscr) modTime() time.Time {
+	if fd.isGhost() {
+		return time.Unix(0, 0)
 	}
-	// 100kB
-	if size <= 102400 {
-		return colors[7]
+
+	return fd.fileInfo.ModTime()
+}
+
+func (fd FileDscr) atime() time.Time {
+	if fd.isGhost() || fd.revEntry != nil {
+		return fd.modTime()
 	}
-	// 256kB
-	if size <= 262144 {
-		return colors[8]
+
+	return fd.stat.ATime()
+}
+
+func (fd FileDscr) ctime() time.Time {
+	if fd.isGhost() || fd.revEntry != nil {
+		return fd.modTime()
 	}
-	// 512kB
-	if size <= 524288 {
-		return colors[9]
+
+	return fd.stat.CTime()
+}
+
+// Returns the number of blocks used by an entry,
+// 0 for ghosts and entries of a revision
+func (fd FileDscr) blocks() int64 {
+	if fd.isGhost() || fd.revEntry != nil {
+		return 0
 	}
 
-	return 196
+	return fd.stat.Blocks()
 }
 
-// Formats size in human readable format
-// if the -H flag is set
-// uses SI if the --si flag is set
-func formatNumber(num int64) string {
-	result := fmt.Sprint(num)
+// Return the color for a file size
+func SizeToColor(size int64) string {
+	return grade(size, theme.SizeSteps, palette().Size)
+}
+
+// How sizes are formatted, see loadSizeOptions
+var sizeOptions = numfmt.Options{Precision: -1}
 
-	if *humanReadableSize {
-		result = numfmt.NumFmt(result, *siSize)
+// Reads the size formatting flags: -H, --si,
+// --precision, --block-size and --thousands
+func loadSizeOptions() error {
+	opts := numfmt.Options{}
+
+	if blockSize := viper.GetString("block-size"); blockSize != "" {
+		var err error
+		if opts, err = numfmt.ParseBlockSize(blockSize); err != nil {
+			return err
+		}
 	}
 
-	return result
-}
+	opts.Human = *humanReadableSize
+	opts.SI = *siSize
+	opts.Precision = viper.GetInt("precision")
+	opts.Thousands = opts.Thousands || viper.GetBool("thousands")
+
+	sizeOptions = opts
 
-var darkTime = []uint8{
-	196,
-	255,
-	252,
-	250,
-	244,
-	244,
-	242,
-	240,
-	238,
+	return nil
 }
 
-var lightTime = []uint8{
-	196,
-	232,
-	235,
-	237,
-	243,
-	243,
-	245,
-	247,
-	249,
+// Formats size in human readable format
+// if the -H flag is set
+// uses SI if the --si flag is set
+// scaled by --block-size otherwise
+func formatNumber(num int64) string {
+	return numfmt.Format(num, sizeOptions)
 }
 
 // Formats and colors time
@@ -180,38 +164,16 @@ var lightTime = []uint8{
 //	31449600 240  # < less than 1 year old
 //	62899200 238  # < less than 2 years old
 func formatTime(t time.Time) string {
-	is_dark := termenv.DefaultOutput().HasDarkBackground()
 	str := t.Format("_2 Jan") + "   " + t.Format("15:04")
-	secs := time.Now().Unix() - t.Unix()
-	var color uint8 = 252
 
-	colors := lightTime
-	if is_dark {
-		colors = darkTime
-		color = 236
-	}
+	return paint(timeColor(t), str)
+}
 
-	if secs <= 0 {
-		color = colors[0]
-	} else if secs <= 60 {
-		color = colors[1]
-	} else if secs <= 3600 {
-		color = colors[2]
-	} else if secs <= 86400 {
-		color = colors[3]
-	} else if secs <= 604800 {
-		color = colors[4]
-	} else if secs <= 2419200 {
-		color = colors[5]
-	} else if secs <= 15724800 {
-		color = colors[6]
-	} else if secs <= 31449600 {
-		color = colors[7]
-	} else if secs <= 62899200 {
-		color = colors[8]
-	}
+// Returns the color for a time, relative to now
+func timeColor(t time.Time) string {
+	secs := time.Now().Unix() - t.Unix()
 
-	return aurora.Index(color, str).String()
+	return grade(secs, theme.AgeSteps, palette().Age)
 }
 
 // Finds the target of a symlink
@@ -219,6 +181,10 @@ func symlinkTarget(fd FileDscr) string {
 	mode := fd.fileInfo.Mode()
 
 	if mode&os.ModeSymlink == os.ModeSymlink {
+		if fd.revEntry != nil {
+			return " -> " + fd.revEntry.Target
+		}
+
 		target, _ := os.Readlink(fd.fullpath)
 
 		return " -> " + target
@@ -227,158 +193,68 @@ func symlinkTarget(fd FileDscr) string {
 	return ""
 }
 
-// Formats and colors a file names.
-// TODO: use $LSCOLORS on macOS
-// Gxfxcxdxbxegedabagacad
-// case $foreground in
-//
-//	  a) foreground_ansi=30;;
-//	  b) foreground_ansi=31;;
-//	  c) foreground_ansi=32;;
-//	  d) foreground_ansi=33;;
-//	  e) foreground_ansi=34;;
-//	  f) foreground_ansi=35;;
-//	  g) foreground_ansi=36;;
-//	  h) foreground_ansi=37;;
-//	  x) foreground_ansi=0;;
-//	esac
-func formatFilename(fd FileDscr, branch string) string {
-	mode := fd.fileInfo.Mode()
-	perm := mode.Perm()
-	isDark := termenv.DefaultOutput().HasDarkBackground()
-	var bg uint8 = 0
-	if !isDark {
-		bg = 15
+// Formats and colors a file names,
+// like ls does with $LS_COLORS or $LSCOLORS
+func formatFilename(fd FileDscr, repo *git.Repo) string {
+	if fd.isGhost() {
+		return colored(ghostColor).CrossOut().Styled(fd.name)
 	}
 
-	if mode.IsDir() {
-		dirname := fd.name
-		// writable by others
-		if perm&0002 == 0002 {
-			if mode&os.ModeSticky == os.ModeSticky {
-				dirname = aurora.Index(0, fd.name).BgIndex(2).String()
-			} else {
-				dirname = aurora.Index(0, fd.name).BgIndex(3).String()
-			}
-		}
-		return dirname + " " + Gray(9, branch).String()
-	}
-
-	if mode&os.ModeSymlink == os.ModeSymlink {
-		return aurora.Index(5, fd.name).BgIndex(bg).String() + symlinkTarget(fd)
-	}
-
-	if mode&os.ModeSocket == os.ModeSocket {
-		return aurora.Index(2, fd.name).BgIndex(bg).String()
-	}
+	mode := fd.fileInfo.Mode()
+	entry := lscolors.Entry{Name: fd.name, Mode: mode}
 
-	if mode&os.ModeNamedPipe == os.ModeNamedPipe {
-		return aurora.Index(3, fd.name).BgIndex(bg).String()
-	}
+	// Entries of a revision are not on the disk
+	onDisk := fd.revEntry == nil
 
-	if mode&os.ModeDevice == os.ModeDevice {
-		return aurora.Index(4, fd.name).BgIndex(6).String()
-	}
+	if onDisk {
+		entry.Links = fd.stat.Links()
 
-	if mode&os.ModeCharDevice == os.ModeCharDevice {
-		return aurora.Index(4, fd.name).BgIndex(3).String()
+		if mode.IsRegular() && fileColors.Enabled("ca") {
+			entry.Capable = HasCapability(fd.fullpath)
+		}
 	}
 
-	if perm&0100 == 0100 {
-		if mode&os.ModeSetuid == os.ModeSetuid {
-			return aurora.Index(0, fd.name).BgIndex(1).String()
-		}
-		if mode&os.ModeSetgid == os.ModeSetgid {
-			return aurora.Index(0, fd.name).BgIndex(6).String()
+	target := ""
+	if mode&os.ModeSymlink == os.ModeSymlink {
+		target = strings.TrimPrefix(symlinkTarget(fd), " -> ")
+		entry.Target = target
+		targetStyle := ""
+
+		if onDisk {
+			if info, err := os.Stat(fd.fullpath); err == nil {
+				entry.TargetMode = info.Mode()
+				targetStyle = fileColors.Style(lscolors.Entry{
+					Name: path.Base(target),
+					Mode: info.Mode(),
+				})
+			} else {
+				entry.Orphan = true
+				targetStyle = fileColors.Missing()
+			}
 		}
 
-		return aurora.Index(1, fd.name).String()
+		target = " -> " + lscolors.Paint(targetStyle, target)
 	}
 
-	return fd.name
-}
+	name := hyperlink(fd, repo, lscolors.Paint(fileColors.Style(entry), fd.name))
 
-// Returns the Git status for a file
-func vcsSatus(fd FileDscr, insideVCS bool) (string, string) {
-	if *noVCS {
-		return "", ""
+	if mode.IsDir() {
+		return name + " " + formatRepo(repo)
 	}
 
-	return git.Status(fd.fullpath, fd.fileInfo, insideVCS)
-}
-
-var darkVCS = map[string]uint8{
-	"DG":      46,
-	" M":      1,
-	"M ":      82,
-	"??":      214,
-	"!!":      238,
-	"A ":      82,
-	"default": 86,
-}
-
-var lightVCS = map[string]uint8{
-	"DG":      34,
-	" M":      9,
-	"M ":      70,
-	"??":      202,
-	"!!":      250,
-	"A ":      70,
-	"default": 74,
-}
-
-var singsVCS = map[string]string{
-	// Directory Good
-	// when out of a repo, but the directory is one
-	"DG": "|",
-	// Dirty
-	" M": "+",
-	// Dirty+Added
-	"M ": "+",
-	// Untracked
-	"??": "+",
-	// Dirty
-	"!!": "|",
-	// Added
-	"A ": "+",
-	// Other cases
-	"default": "|",
-}
-
-func hasKey[K comparable, V any](m map[K]V, key K) bool {
-	_, ok := m[key]
-	return ok
+	return name + target
 }
 
-// Colors the VCS status marker
-func formatVCSStatus(status string) string {
-	if *noVCS {
-		return ""
-	}
-
-	if status == "--" {
-		return " "
-	}
-
-	isDark := termenv.DefaultOutput().HasDarkBackground()
-	colors := lightVCS
-	if isDark {
-		colors = darkVCS
-	}
-
-	if hasKey(colors, status) && hasKey(singsVCS, status) {
-		return aurora.Index(colors[status], singsVCS[status]).String()
-	}
-
-	return aurora.Index(colors["default"], singsVCS["default"]).String()
-}
+// Colors of file names: the ones of $LS_COLORS
+// or $LSCOLORS, or the ones of the theme
+var fileColors = lscolors.New(nil)
 
 func formatUsername(username string) string {
-	return Gray(9, username).String()
+	return paint(palette().Owner, username)
 }
 
 func formatGroupname(group string) string {
-	return Gray(9, group).String()
+	return paint(palette().Group, group)
 }
 
 func formatLinks(links uint64) string {
@@ -389,29 +265,54 @@ func formatSize(size int64) string {
 	color := SizeToColor(size)
 	str := formatNumber(size)
 
-	return Index(color, str).String()
+	return paint(color, str)
 }
 
 // Prints a line to a tabwrite
 // with proper formating and such
-func PrintLine(writer *tabwriter.Writer, f FileDscr, insideVCS bool) {
-	mode := f.fileInfo.Mode().String()
-	links := f.stat.Links()
-
-	username := f.stat.Username()
-	groupname := f.stat.Group()
-
-	vcs, branch := vcsSatus(f, insideVCS)
-
-	elemts := []string{
-		mode,
-		formatLinks(links),
-		formatUsername(username),
-		formatGroupname(groupname),
-		formatSize(f.fileInfo.Size()),
-		formatTime(f.fileInfo.ModTime()),
+// 'history' and 'diffStats' are nil unless the last
+// commits and the diff stats are shown
+// 'repos' describes the repositories of the listing
+func PrintLine(writer *tabwriter.Writer, f FileDscr, statuses *git.Statuses, repos map[string]*git.Repo, history *git.History, diffStats *git.DiffStats) {
+	vcs, repo := vcsSatus(f, statuses, repos)
+
+	var elemts []string
+	if f.isGhost() {
+		elemts = ghostElements(f)
+	} else if f.revEntry != nil {
+		elemts = revElements(f)
+	} else {
+		mode := f.fileInfo.Mode().String()
+		links := f.stat.Links()
+
+		username := f.stat.Username()
+		groupname := f.stat.Group()
+
+		elemts = []string{
+			mode,
+			formatLinks(links),
+			formatUsername(username),
+			formatGroupname(groupname),
+			formatSize(f.fileInfo.Size()),
+			formatTime(f.fileInfo.ModTime()),
+		}
+	}
+
+	if history != nil {
+		elemts = append(elemts, formatLastCommit(history.LastCommit(f.fullpath))...)
+	}
+
+	if diffStats != nil {
+		elemts = append(elemts, formatDiffStat(diffStats.Stat(f.fullpath))...)
+	}
+
+	elemts = append(elemts,
 		formatVCSStatus(vcs),
-		" " + formatFilename(f, branch),
+		" "+formatFilename(f, repo),
+	)
+
+	if vcs == "!!" && viper.GetBool("dim-ignored") {
+		elemts = dimRow(elemts)
 	}
 
 	fmt.Fprintln(writer, strings.Join(elemts, "\t"))
@@ -419,8 +320,7 @@ func PrintLine(writer *tabwriter.Writer, f FileDscr, insideVCS bool) {
 
 // Returns whether a line should be printed for a file
 // accordinf to flags
-func shouldPrint(name string, f os.DirEntry) bool {
-	isDir := f.IsDir()
+func shouldPrint(name string, isDir bool) bool {
 	isHidden := strings.HasPrefix(name, ".")
 	showHidden := *listAlmostAll || *listAll
 
@@ -452,39 +352,63 @@ func sortFn(a, b int64, reverse bool) bool {
 	return result
 }
 
-func sortDescriptors(fds []FileDscr) []FileDscr {
+// 'statuses' is used to sort by git status, and is
+// nil outside of work trees
+func sortDescriptors(fds []FileDscr, statuses *git.Statuses) []FileDscr {
 	if *sortSize {
 		sort.Slice(fds, func(i, j int) bool {
-			sizeI := fds[i].fileInfo.Size()
-			sizeJ := fds[j].fileInfo.Size()
+			sizeI := fds[i].size()
+			sizeJ := fds[j].size()
 
 			return sortFn(sizeI, sizeJ, *reverseSort)
 		})
 	}
 	if *sortModTime {
 		sort.Slice(fds, func(i, j int) bool {
-			modTimeI := fds[i].fileInfo.ModTime().UnixNano()
-			modTimeJ := fds[j].fileInfo.ModTime().UnixNano()
+			modTimeI := fds[i].modTime().UnixNano()
+			modTimeJ := fds[j].modTime().UnixNano()
 
 			return sortFn(modTimeI, modTimeJ, *reverseSort)
 		})
 	}
 	if *sortAtime {
 		sort.Slice(fds, func(i, j int) bool {
-			atimeI := fds[i].stat.ATime().UnixNano()
-			atimeJ := fds[j].stat.ATime().UnixNano()
+			atimeI := fds[i].atime().UnixNano()
+			atimeJ := fds[j].atime().UnixNano()
 
 			return sortFn(atimeI, atimeJ, *reverseSort)
 		})
 	}
 	if *sortCtime {
 		sort.Slice(fds, func(i, j int) bool {
-			ctimeI := fds[i].stat.CTime().UnixNano()
-			ctimeJ := fds[j].stat.CTime().UnixNano()
+			ctimeI := fds[i].ctime().UnixNano()
+			ctimeJ := fds[j].ctime().UnixNano()
 
 			return sortFn(ctimeI, ctimeJ, *reverseSort)
 		})
 	}
+	if sortGit {
+		ranks := make(map[string]int)
+		for _, fd := range fds {
+			ranks[fd.fullpath] = gitRank(fd, statuses)
+		}
+
+		sort.SliceStable(fds, func(i, j int) bool {
+			rankI := ranks[fds[i].fullpath]
+			rankJ := ranks[fds[j].fullpath]
+
+			less := rankI < rankJ
+			if rankI == rankJ {
+				less = fds[i].name < fds[j].name
+			}
+
+			if *reverseSort {
+				return !less
+			}
+
+			return less
+		})
+	}
 
 	return fds
 }
@@ -492,6 +416,11 @@ func sortDescriptors(fds []FileDscr) []FileDscr {
 func handleSortFlag(cmd *cobra.Command) {
 	sortBy, _ = cmd.Flags().GetString("sort")
 
+	if sortBy == "git" {
+		sortGit = true
+		return
+	}
+
 	for _, r := range sortBy {
 		switch r {
 		case 's':
@@ -509,6 +438,10 @@ func handleSortFlag(cmd *cobra.Command) {
 		case 'a':
 			*sortAtime = true
 			continue
+
+		case 'g':
+			sortGit = true
+			continue
 		}
 	}
 }
@@ -533,7 +466,10 @@ func handleArgs(args []string) string {
 	return cwd
 }
 
-func getDescriptors(cwd string) []FileDscr {
+// 'statuses' is nil outside of git work trees, otherwise
+// the tracked entries deleted from the work tree are
+// listed too, as ghosts
+func getDescriptors(cwd string, statuses *git.Statuses) []FileDscr {
 	files, err := os.ReadDir(cwd)
 	if err != nil {
 		panic(err)
@@ -547,22 +483,24 @@ func getDescriptors(cwd string) []FileDscr {
 		dotdot, _ := os.Stat(path.Dir(cwd))
 
 		dotD := FileDscr{
-			".",
-			cwd,
-			dot,
-			NewPlatformStat(dot),
+			name:     ".",
+			fullpath: cwd,
+			fileInfo: dot,
+			stat:     NewPlatformStat(dot),
 		}
 
 		dotdotD := FileDscr{
-			"..",
-			path.Dir(cwd),
-			dotdot,
-			NewPlatformStat(dotdot),
+			name:     "..",
+			fullpath: path.Dir(cwd),
+			fileInfo: dotdot,
+			stat:     NewPlatformStat(dotdot),
 		}
 
 		descriptors = append(descriptors, dotD, dotdotD)
 	}
 
+	dots := len(descriptors)
+
 	// Actual file list
 	for _, file := range files {
 		fileInfo, err := file.Info()
@@ -570,17 +508,29 @@ func getDescriptors(cwd string) []FileDscr {
 			continue
 		}
 
-		if shouldPrint(file.Name(), file) {
+		fullpath := path.Join(cwd, file.Name())
+
+		if shouldPrint(file.Name(), file.IsDir()) && shouldPrintStatus(fullpath, file.IsDir(), statuses) {
 			descriptors = append(descriptors, FileDscr{
-				file.Name(),
-				path.Join(cwd, file.Name()),
-				fileInfo,
-				NewPlatformStat(fileInfo),
+				name:     file.Name(),
+				fullpath: fullpath,
+				fileInfo: fileInfo,
+				stat:     NewPlatformStat(fileInfo),
 			})
 		}
 	}
 
-	return sortDescriptors(descriptors)
+	// Deleted entries, in name order with the others
+	if ghosts := ghostDescriptors(cwd, statuses); len(ghosts) > 0 {
+		descriptors = append(descriptors, ghosts...)
+
+		listed := descriptors[dots:]
+		sort.SliceStable(listed, func(i, j int) bool {
+			return listed[i].name < listed[j].name
+		})
+	}
+
+	return sortDescriptors(descriptors, statuses)
 }
 
 // rootCmd represents the base command when called without any subcommands
@@ -595,15 +545,105 @@ on files and directories.`,
 	// TODO: handle absolute paths
 	Args: cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
-		// Waiting line
-		fmt.Print("Reading directory…")
+		if err := git.SetBackend(viper.GetString("git-backend")); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := loadTheme(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		loadVCSConfig()
+
+		if err := loadColorMode(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := loadBackground(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fileColors = lscolors.FromEnvironment()
+		if fileColors == nil {
+			fileColors = lscolors.New(palette().Files)
+		}
+		if !colorOutput {
+			fileColors = lscolors.New(nil)
+		}
+
+		if err := loadSizeOptions(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := loadHyperlinks(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		printWaiting()
 
 		handleSortFlag(cmd)
 
 		cwd := handleArgs(args)
-		descriptors := getDescriptors(cwd)
 
-		insideVCS := git.IsInWorkTree()
+		if *reposMode {
+			printRepos(cwd, *reposDepth)
+			return
+		}
+
+		var descriptors []FileDscr
+		var statuses *git.Statuses
+		var history *git.History
+		var diffStats *git.DiffStats
+
+		if *revision != "" {
+			if err := checkRevFlags(cmd); err != nil {
+				clearWaiting()
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			var err error
+			if descriptors, history, err = getRevDescriptors(cwd, *revision); err != nil {
+				clearWaiting()
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		} else {
+			// Status of the whole directory, in one go
+			if !*noVCS {
+				statuses, _ = git.LoadStatuses(cwd, true)
+			}
+
+			descriptors = getDescriptors(cwd, statuses)
+
+			// Last commits, in one walk of the history
+			var commits *git.History
+			if (*gitLog || timeFlags.source == timeCommit) && statuses != nil {
+				commits, _ = git.LoadHistory(cwd, "", trackedNames(descriptors, statuses))
+			}
+
+			if *gitLog {
+				history = commits
+			}
+
+			if timeFlags.source == timeCommit && commits != nil {
+				descriptors = sortDescriptors(withCommitTimes(descriptors, commits), statuses)
+			}
+
+			// Lines changed, in one diff against HEAD
+			if *diffStat && statuses != nil {
+				diffStats, _ = git.LoadDiffStats(cwd)
+			}
+		}
+
+		// Nested repositories, checked concurrently
+		repos := loadRepos(descriptors, statuses)
 
 		writer := tabwriter.NewWriter(
 			os.Stdout,
@@ -612,17 +652,16 @@ on files and directories.`,
 			1,
 			' ',
 			tabwriter.AlignRight,
-		)
+		).SetColumns(listingColumns...)
 
 		var blocks int64 = 0
 		for _, d := range descriptors {
-			blocks += d.stat.Blocks()
+			blocks += d.blocks()
 
-			PrintLine(writer, d, insideVCS)
+			PrintLine(writer, d, statuses, repos, history, diffStats)
 		}
 
-		// Clear waiting line
-		fmt.Print("\r                  \r")
+		clearWaiting()
 
 		// Final Output
 		fmt.Printf(" total %d\n", blocks)
@@ -630,6 +669,56 @@ on files and directories.`,
 	},
 }
 
+// Widest user and group names, longer ones being cut
+const maxOwnerWidth = 16
+
+// Columns of the listing that are not right-aligned:
+// like ls, the mode, user and group are aligned left
+var listingColumns = []tabwriter.Column{
+	{Align: tabwriter.Left},
+	{Align: tabwriter.Right},
+	{Align: tabwriter.Left, MaxWidth: maxOwnerWidth},
+	{Align: tabwriter.Left, MaxWidth: maxOwnerWidth},
+}
+
+// Times shown and sorted by, set with --time=WORD
+const (
+	timeMtime  = "mtime"
+	timeCommit = "commit"
+)
+
+// timeFlag is the value of -t/--time, that sorts by time
+// without a value, and selects the time with a WORD
+type timeFlag struct {
+	sort   bool
+	source string
+}
+
+var timeFlags = timeFlag{source: timeMtime}
+
+func (f *timeFlag) String() string {
+	return f.source
+}
+
+func (f *timeFlag) Set(value string) error {
+	switch value {
+	case "true":
+		f.sort = true
+	case "false":
+		f.sort = false
+	case timeMtime, timeCommit:
+		f.source = value
+	default:
+		return fmt.Errorf("unknown time %q (expected mtime or commit)", value)
+	}
+
+	return nil
+}
+
+func (f *timeFlag) Type() string {
+	return "WORD"
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -653,7 +742,17 @@ var (
 	sortAtime           *bool
 	dontSort            *bool
 	sortBy              string
+	sortGit             bool
 	noVCS               *bool
+	gitLog              *bool
+	diffStat            *bool
+	revision            *string
+	filterModified      *bool
+	filterStaged        *bool
+	filterUntracked     *bool
+	filterConflicted    *bool
+	reposMode           *bool
+	reposDepth          *int
 )
 
 func init() {
@@ -673,21 +772,87 @@ func init() {
 	humanReadableSize = rootCmd.Flags().
 		BoolP("human", "H", false, "show file sizes in human readable format")
 	siSize = rootCmd.Flags().
-		Bool("si", false, "with -h, use powers of 1000 not 1024")
+		Bool("si", false, "with -H, use powers of 1000 not 1024")
+	rootCmd.Flags().
+		Int("precision", -1, "with -H, the number of decimals (default: one\nbelow 10, none above)")
+	viper.BindPFlag("precision", rootCmd.Flags().Lookup("precision"))
+	rootCmd.Flags().
+		String("block-size", "", "scale sizes by SIZE before printing them:\nK, M, G… (powers of 1024), KB, MB…\n(powers of 1000), or an integer with a unit\n(1K), a leading ' groups digits by thousands")
+	viper.BindPFlag("block-size", rootCmd.Flags().Lookup("block-size"))
+	rootCmd.Flags().
+		Bool("thousands", false, "group the digits of sizes by thousands")
+	viper.BindPFlag("thousands", rootCmd.Flags().Lookup("thousands"))
 	reverseSort = rootCmd.Flags().
 		BoolP("reverse", "r", false, "reverse sort order")
 	sortSize = rootCmd.Flags().BoolP("size", "S", false, "sort by size")
-	sortModTime = rootCmd.Flags().
-		BoolP("time", "t", false, "sort by modification time")
+	sortModTime = &timeFlags.sort
+	rootCmd.Flags().
+		VarP(&timeFlags, "time", "t", "sort by modification time, or with WORD,\nthe time to show and sort by: mtime,\nor commit (last commit, mtime if untracked)")
+	rootCmd.Flags().Lookup("time").NoOptDefVal = "true"
 	sortAtime = rootCmd.Flags().
 		BoolP("atime", "u", false, "sort by atime (use of access time)")
 	dontSort = rootCmd.Flags().BoolP("unsorted", "U", false, "unsorted")
 
 	rootCmd.Flags().
-		String("sort", "n", "sort by WORD: none (U), size (s),\ntime (t), ctime or status (c),\natime or access time or use (a)")
+		String("sort", "n", "sort by WORD: none (U), size (s),\ntime (t), ctime or status (c),\natime or access time or use (a),\ngit status (git or g)")
 
 	noVCS = rootCmd.Flags().
 		Bool("no-vcs", false, "do not get VCS stats (much faster)")
+	gitLog = rootCmd.Flags().
+		Bool("git-log", false, "show the last commit of each entry\n(hash, author and age)")
+	diffStat = rootCmd.Flags().
+		Bool("diff-stat", false, "show the number of lines added\nand removed in changed files")
+	rootCmd.Flags().
+		Bool("git-ignore", false, "hide the entries ignored by git\n(shown again with -a or -A)")
+	viper.BindPFlag("git-ignore", rootCmd.Flags().Lookup("git-ignore"))
+	rootCmd.Flags().
+		Bool("dim-ignored", false, "dim the rows of the entries ignored by git")
+	viper.BindPFlag("dim-ignored", rootCmd.Flags().Lookup("dim-ignored"))
+
+	filterModified = rootCmd.Flags().
+		Bool("modified", false, "only list entries with unstaged changes")
+	filterStaged = rootCmd.Flags().
+		Bool("staged", false, "only list entries with staged changes")
+	filterUntracked = rootCmd.Flags().
+		Bool("untracked", false, "only list untracked entries")
+	filterConflicted = rootCmd.Flags().
+		Bool("conflicted", false, "only list entries with merge conflicts")
+
+	revision = rootCmd.Flags().
+		String("rev", "", "list the directory as of a git revision\n(commit, branch, tag…)")
+
+	reposMode = rootCmd.Flags().
+		Bool("repos", false, "list the repositories below the directory\nwith their branch, changes and last commit")
+	reposDepth = rootCmd.Flags().
+		Int("repos-depth", 1, "with --repos, how deep to look for repositories")
+
+	rootCmd.Flags().
+		String("git-backend", git.BackendAuto, "how to read git information: auto, exec (run git)\nor native (read the repository files)")
+	viper.BindPFlag("git-backend", rootCmd.Flags().Lookup("git-backend"))
+
+	rootCmd.Flags().
+		String("color", colorAuto, "when to color the output: auto (on terminals,\nunless $NO_COLOR is set), always or never")
+	rootCmd.Flags().Lookup("color").NoOptDefVal = colorAlways
+	viper.BindPFlag("color", rootCmd.Flags().Lookup("color"))
+
+	rootCmd.Flags().
+		String("hyperlink", hyperlinkAuto, "when to link file names (OSC 8): auto\n(on terminals), always or never")
+	rootCmd.Flags().Lookup("hyperlink").NoOptDefVal = hyperlinkAlways
+	viper.BindPFlag("hyperlink", rootCmd.Flags().Lookup("hyperlink"))
+
+	rootCmd.Flags().
+		String("background", backgroundAuto, "background of the terminal, for the colors\nof the theme: auto (ask the terminal), dark or light")
+	viper.BindPFlag("background", rootCmd.Flags().Lookup("background"))
+	viper.BindEnv("background", "K_BACKGROUND")
+
+	rootCmd.Flags().
+		String("theme", "", "color theme: default, mono, or one\nof the themes of the config file")
+	viper.BindPFlag("theme", rootCmd.Flags().Lookup("theme"))
+	viper.BindEnv("theme", "K_THEME")
+
+	rootCmd.Flags().
+		String("vcs-style", vcsStyleMarker, "VCS status style: marker (one sign)\nor xy (index and work tree glyphs)")
+	viper.BindPFlag("vcs.style", rootCmd.Flags().Lookup("vcs-style"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -711,7 +876,6 @@ func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
-	}
+	// Silently, so it doesn't end up in the listing
+	viper.ReadInConfig()
 }
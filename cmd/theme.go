@@ -0,0 +1,614 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/muesli/termenv"
+	"github.com/spf13/viper"
+
+	"github.com/gaelph/k/internal/term"
+)
+
+// Theme holds the colors and the VCS signs of a listing
+type Theme struct {
+	// Upper bounds of the size grades, in bytes
+	SizeSteps []int64 `mapstructure:"size-steps"`
+	// Upper bounds of the age grades, in seconds,
+	// 0 standing for dates in the future
+	AgeSteps []int64 `mapstructure:"age-steps"`
+	// Signs of the marker style, by VCS state
+	Signs map[string]string
+	// Glyphs of the xy style, by porcelain letter
+	Glyphs map[string]string
+	// Signs of the branch tracking information
+	TrackingSigns map[string]string `mapstructure:"tracking-signs"`
+	// Signs of the counts of the repository dashboard,
+	// distinct so they read without colors
+	DashboardSigns map[string]string `mapstructure:"dashboard-signs"`
+
+	Dark  Palette
+	Light Palette
+}
+
+// Palette holds the colors of a theme for a terminal
+// background, as hex colors ("#ff8700") or ANSI color
+// indexes ("208"), converted to the colors the terminal
+// supports
+type Palette struct {
+	// A color per size step, then one for larger sizes
+	Size []string
+	// A color per age step, then one for older dates
+	Age []string
+	// By VCS state
+	VCS map[string]string
+	// Branch tracking information
+	Tracking map[string]string
+	// Last commits
+	History map[string]string
+	// Lines added and removed, with --diff-stat
+	Diff  map[string]string
+	Owner string
+	Group string
+	// File name colors, keyed and formatted like
+	// $LS_COLORS ("di": "01;34", "*.go": "38;5;81"),
+	// used as they are
+	Files map[string]string
+}
+
+const defaultTheme = "default"
+
+// Themes that come with k, user themes are read from the
+// "themes" key of the config file
+var builtinThemes = map[string]Theme{
+	"default": {
+		SizeSteps: []int64{1024, 2048, 3072, 5120, 10240, 20480, 40960, 102400, 262144, 524288},
+		AgeSteps:  []int64{0, 60, 3600, 86400, 604800, 2419200, 15724800, 31449600, 62899200},
+		Signs: map[string]string{
+			// Directory Good
+			// when out of a repo, but the directory is one
+			"repo-clean": "|",
+			// Changes in the work tree: modified, file became
+			// a symlink or the other way around, deleted, and
+			// added with --intent-to-add
+			"modified":      "+",
+			"typechange":    "~",
+			"deleted":       "-",
+			"intent-to-add": "✚",
+			// Changes in the index
+			"staged":            "+",
+			"staged-typechange": "~",
+			"added":             "✚",
+			"staged-deleted":    "-",
+			"renamed":           "→",
+			"copied":            "⇉",
+			// Unmerged, both sides changed
+			"conflict": "✖",
+			// Untracked
+			"untracked": "+",
+			// Ignored
+			"ignored": "|",
+			// Other cases
+			"default": "|",
+		},
+		Glyphs: map[string]string{
+			"modified":   "M",
+			"typechange": "T",
+			"added":      "A",
+			"deleted":    "D",
+			"renamed":    "R",
+			"copied":     "C",
+			"unmerged":   "U",
+			"untracked":  "?",
+			"ignored":    "!",
+		},
+		TrackingSigns: map[string]string{
+			// Commits to push
+			"ahead": "↑",
+			// Commits to pull
+			"behind": "↓",
+			// The upstream branch was deleted
+			"gone": "⊘",
+			// No upstream branch
+			"none": "∅",
+			// Stash entries
+			"stash": "≡",
+			// Submodule not at the commit recorded in the superproject
+			"moved": "≠",
+		},
+		DashboardSigns: map[string]string{
+			"conflict":  "✖",
+			"staged":    "+",
+			"modified":  "!",
+			"untracked": "?",
+		},
+		Dark: Palette{
+			Size: []string{"46", "82", "118", "154", "190", "226", "220", "214", "208", "202", "196"},
+			Age:  []string{"196", "255", "252", "250", "244", "244", "242", "240", "238", "236"},
+			VCS: map[string]string{
+				"repo-clean":        "46",
+				"modified":          "1",
+				"typechange":        "208",
+				"deleted":           "1",
+				"intent-to-add":     "1",
+				"staged":            "82",
+				"staged-typechange": "148",
+				"added":             "40",
+				"staged-deleted":    "82",
+				"renamed":           "45",
+				"copied":            "39",
+				"conflict":          "201",
+				"untracked":         "214",
+				"ignored":           "238",
+				"default":           "86",
+			},
+			Tracking: map[string]string{
+				"ahead":     "46",
+				"behind":    "196",
+				"gone":      "196",
+				"none":      "238",
+				"operation": "214",
+				"stash":     "86",
+				"moved":     "214",
+				"kind":      "242",
+			},
+			History: map[string]string{
+				"hash": "178",
+			},
+			Diff: map[string]string{
+				"added":   "2",
+				"removed": "1",
+			},
+			Owner: "241",
+			Group: "241",
+			Files: map[string]string{
+				"ln": "35;40",
+				"so": "32;40",
+				"pi": "33;40",
+				"bd": "34;46",
+				"cd": "34;43",
+				"ex": "31",
+				"su": "30;41",
+				"sg": "30;46",
+				"tw": "30;42",
+				"ow": "30;43",
+			},
+		},
+		Light: Palette{
+			Size: []string{"34", "70", "106", "142", "178", "214", "208", "202", "196", "160", "196"},
+			Age:  []string{"196", "232", "235", "237", "243", "243", "245", "247", "249", "252"},
+			VCS: map[string]string{
+				"repo-clean":        "34",
+				"modified":          "9",
+				"typechange":        "166",
+				"deleted":           "9",
+				"intent-to-add":     "9",
+				"staged":            "70",
+				"staged-typechange": "106",
+				"added":             "28",
+				"staged-deleted":    "70",
+				"renamed":           "31",
+				"copied":            "25",
+				"conflict":          "163",
+				"untracked":         "202",
+				"ignored":           "250",
+				"default":           "74",
+			},
+			Tracking: map[string]string{
+				"ahead":     "34",
+				"behind":    "160",
+				"gone":      "160",
+				"none":      "250",
+				"operation": "202",
+				"stash":     "74",
+				"moved":     "202",
+				"kind":      "244",
+			},
+			History: map[string]string{
+				"hash": "136",
+			},
+			Diff: map[string]string{
+				"added":   "2",
+				"removed": "1",
+			},
+			Owner: "241",
+			Group: "241",
+			Files: map[string]string{
+				"ln": "35;107",
+				"so": "32;107",
+				"pi": "33;107",
+				"bd": "34;46",
+				"cd": "34;43",
+				"ex": "31",
+				"su": "30;41",
+				"sg": "30;46",
+				"tw": "30;42",
+				"ow": "30;43",
+			},
+		},
+	},
+}
+
+// Signs of the entries changed in both the index and the
+// work tree, by change in the work tree
+var bothChangedSigns = map[string]string{
+	"modified":   "±",
+	"typechange": "≈",
+	"deleted":    "∓",
+}
+
+// Adds the states of the entries changed in both the index
+// and the work tree, named after both ("added+modified"), with
+// the sign of the change in the work tree and the color of
+// the change in the index
+func addBothChangedStates(t Theme) {
+	// A deletion staged leaves nothing to change in the work tree
+	for _, index := range []string{"staged", "staged-typechange", "added", "renamed", "copied"} {
+		for workTree, sign := range bothChangedSigns {
+			state := index + "+" + workTree
+
+			t.Signs[state] = sign
+			t.Dark.VCS[state] = t.Dark.VCS[index]
+			t.Light.VCS[state] = t.Light.VCS[index]
+		}
+	}
+}
+
+func init() {
+	addBothChangedStates(builtinThemes[defaultTheme])
+
+	// Shades of gray, with the signs of the default
+	// theme telling the VCS states apart
+	mono := builtinThemes[defaultTheme].clone()
+
+	mono.Dark.Size = []string{"240", "241", "242", "243", "244", "245", "246", "247", "248", "249", "250"}
+	mono.Dark.Age = []string{"255", "255", "252", "250", "248", "246", "244", "242", "240", "238"}
+	mono.Light.Size = []string{"250", "249", "248", "247", "246", "245", "244", "243", "242", "241", "240"}
+	mono.Light.Age = []string{"232", "232", "235", "237", "239", "241", "243", "245", "247", "249"}
+
+	for _, p := range []*Palette{&mono.Dark, &mono.Light} {
+		for state := range p.VCS {
+			p.VCS[state] = "245"
+		}
+		for key := range p.Tracking {
+			p.Tracking[key] = "245"
+		}
+		p.VCS["conflict"] = p.Age[0]
+		p.History["hash"] = "245"
+		p.Diff["added"] = "245"
+		p.Diff["removed"] = "245"
+		p.Files = map[string]string{"di": "01", "ex": "04", "ln": "03"}
+	}
+	mono.Dark.VCS["ignored"] = "238"
+	mono.Light.VCS["ignored"] = "250"
+
+	builtinThemes["mono"] = mono
+}
+
+// Theme of the listing, see loadTheme
+var theme = builtinThemes[defaultTheme].clone()
+
+// Returns a deep copy of a theme
+func (t Theme) clone() Theme {
+	t.SizeSteps = append([]int64(nil), t.SizeSteps...)
+	t.AgeSteps = append([]int64(nil), t.AgeSteps...)
+	t.Signs = cloneMap(t.Signs)
+	t.Glyphs = cloneMap(t.Glyphs)
+	t.TrackingSigns = cloneMap(t.TrackingSigns)
+	t.DashboardSigns = cloneMap(t.DashboardSigns)
+	t.Dark = t.Dark.clone()
+	t.Light = t.Light.clone()
+
+	return t
+}
+
+func (p Palette) clone() Palette {
+	p.Size = append([]string(nil), p.Size...)
+	p.Age = append([]string(nil), p.Age...)
+	p.VCS = cloneMap(p.VCS)
+	p.Tracking = cloneMap(p.Tracking)
+	p.History = cloneMap(p.History)
+	p.Diff = cloneMap(p.Diff)
+	p.Files = cloneMap(p.Files)
+
+	return p
+}
+
+func cloneMap[V any](m map[string]V) map[string]V {
+	result := make(map[string]V, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+
+	return result
+}
+
+// Returns the names of the built-in and user themes
+func themeNames() []string {
+	names := []string{}
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+
+	for name := range viper.GetStringMap("themes") {
+		if _, ok := builtinThemes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Returns the theme called 'name': a built-in theme, or a user
+// theme of the config file, which overrides the theme it extends
+// ("default" unless set), or a built-in theme of the same name
+//
+//	themes:
+//	  mine:
+//	    extends: mono
+//	    size-steps: [4096, 1048576]
+//	    dark:
+//	      size: [28, 142, 160]
+//	      owner: 244
+//	      files:
+//	        di: "01;34"
+//	        "*.go": "38;5;81"
+func findTheme(name string, seen map[string]bool) (Theme, error) {
+	key := "themes." + name
+
+	if !viper.IsSet(key) {
+		if t, ok := builtinThemes[name]; ok {
+			return t.clone(), nil
+		}
+
+		return Theme{}, fmt.Errorf("unknown theme %q, available themes: %s", name, strings.Join(themeNames(), ", "))
+	}
+
+	if seen[name] {
+		return Theme{}, fmt.Errorf("theme %q extends itself", name)
+	}
+	seen[name] = true
+
+	// User themes named like a built-in theme extend it
+	base := viper.GetString(key + ".extends")
+	_, builtin := builtinThemes[name]
+
+	var t Theme
+	var err error
+	switch {
+	case builtin && (base == "" || base == name):
+		t = builtinThemes[name].clone()
+	case base == "":
+		base = defaultTheme
+		fallthrough
+	default:
+		if t, err = findTheme(base, seen); err != nil {
+			return Theme{}, err
+		}
+	}
+
+	// Lists replace the ones of the base theme,
+	// maps are merged with them
+	lists := map[string]any{
+		"size-steps": &t.SizeSteps,
+		"age-steps":  &t.AgeSteps,
+		"dark.size":  &t.Dark.Size,
+		"dark.age":   &t.Dark.Age,
+		"light.size": &t.Light.Size,
+		"light.age":  &t.Light.Age,
+	}
+	for list, field := range lists {
+		if !viper.IsSet(key + "." + list) {
+			continue
+		}
+
+		switch field := field.(type) {
+		case *[]int64:
+			*field = nil
+		case *[]string:
+			*field = nil
+		}
+	}
+
+	if err := viper.UnmarshalKey(key, &t); err != nil {
+		return Theme{}, fmt.Errorf("theme %q: %w", name, err)
+	}
+
+	return t, nil
+}
+
+// Returns an error when the steps of a theme don't increase, or
+// a palette has invalid colors, or doesn't have a color for each
+// step, and one more
+func (t Theme) validate(name string) error {
+	for kind, steps := range map[string][]int64{"size": t.SizeSteps, "age": t.AgeSteps} {
+		if !sort.SliceIsSorted(steps, func(i, j int) bool { return steps[i] < steps[j] }) {
+			return fmt.Errorf("theme %q: %s steps must increase", name, kind)
+		}
+	}
+
+	for background, p := range map[string]Palette{"dark": t.Dark, "light": t.Light} {
+		colors := append(append([]string{p.Owner, p.Group}, p.Size...), p.Age...)
+		for _, m := range []map[string]string{p.VCS, p.Tracking, p.History, p.Diff} {
+			for _, color := range m {
+				colors = append(colors, color)
+			}
+		}
+
+		for _, color := range colors {
+			if !validColor(color) {
+				return fmt.Errorf("theme %q: invalid %s color %q, expected a hex color (#ff8700) or a color index (0-255)",
+					name, background, color)
+			}
+		}
+
+		if len(p.Size) != len(t.SizeSteps)+1 {
+			return fmt.Errorf("theme %q: %d %s size colors for %d size steps, expected %d",
+				name, len(p.Size), background, len(t.SizeSteps), len(t.SizeSteps)+1)
+		}
+
+		if len(p.Age) != len(t.AgeSteps)+1 {
+			return fmt.Errorf("theme %q: %d %s age colors for %d age steps, expected %d",
+				name, len(p.Age), background, len(t.AgeSteps), len(t.AgeSteps)+1)
+		}
+	}
+
+	return nil
+}
+
+// Returns true for hex colors and ANSI color indexes
+func validColor(color string) bool {
+	if strings.HasPrefix(color, "#") {
+		_, err := colorful.Hex(color)
+		return err == nil
+	}
+
+	index, err := strconv.Atoi(color)
+
+	return err == nil && index >= 0 && index <= 255
+}
+
+// Selects the theme of the --theme flag, $K_THEME or
+// the "theme" key of the config file, "default" if unset
+func loadTheme() error {
+	name := viper.GetString("theme")
+	if name == "" {
+		name = defaultTheme
+	}
+
+	t, err := findTheme(name, map[string]bool{})
+	if err != nil {
+		return err
+	}
+
+	if err := t.validate(name); err != nil {
+		return err
+	}
+
+	theme = t
+
+	return nil
+}
+
+// Values of --background
+const (
+	backgroundAuto  = "auto"
+	backgroundDark  = "dark"
+	backgroundLight = "light"
+)
+
+// How long the terminal has to report its background color
+const backgroundTimeout = 200 * time.Millisecond
+
+// Whether the background of the terminal is dark, see loadBackground
+var isDarkBackground = true
+
+// Finds out whether the background of the terminal is dark,
+// once: from --background, $K_BACKGROUND or the "background"
+// key of the config file, then from $COLORFGBG, and last by
+// asking the terminal. Dark is assumed when it can't tell
+//
+// Must be called after loadColorMode: nothing is asked
+// when the output is not colored
+func loadBackground() error {
+	switch mode := viper.GetString("background"); mode {
+	case backgroundDark:
+		isDarkBackground = true
+		return nil
+	case backgroundLight:
+		isDarkBackground = false
+		return nil
+	case backgroundAuto, "":
+	default:
+		return fmt.Errorf("invalid background %q, expected auto, dark or light", mode)
+	}
+
+	isDarkBackground = true
+
+	// "<foreground>;<background>", or "<foreground>;default;<background>",
+	// of the 16 ANSI colors, as set by rxvt and others
+	if fgbg := os.Getenv("COLORFGBG"); strings.Contains(fgbg, ";") {
+		fields := strings.Split(fgbg, ";")
+		if bg, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+			isDarkBackground = bg < 7 || bg == 8
+			return nil
+		}
+	}
+
+	if !colorOutput || !stdoutIsTerminal() {
+		return nil
+	}
+
+	if bg, err := term.BackgroundColor(backgroundTimeout); err == nil {
+		_, _, lightness := bg.Hsl()
+		isDarkBackground = lightness < 0.5
+	}
+
+	return nil
+}
+
+// Returns the palette of the theme for
+// the background of the terminal
+func palette() *Palette {
+	if isDarkBackground {
+		return &theme.Dark
+	}
+
+	return &theme.Light
+}
+
+// Returns true when the background of the terminal is dark
+func darkBackground() bool {
+	return isDarkBackground
+}
+
+// Returns the color of the first step 'value' is
+// not above, or the last color when it's above all
+//
+// On truecolor terminals, values between two steps
+// fade from the color of the first step to the color
+// of the second one, on a logarithmic scale, so that
+// values on a step have its color in both modes
+func grade(value int64, steps []int64, colors []string) string {
+	i := sort.Search(len(steps), func(i int) bool {
+		return value <= steps[i]
+	})
+
+	if profile != termenv.TrueColor || i == 0 || i == len(steps) {
+		return colors[i]
+	}
+
+	low, high := float64(steps[i-1]), float64(steps[i])
+	position := (float64(value) - low) / (high - low)
+	if low > 0 {
+		position = math.Log(float64(value)/low) / math.Log(high/low)
+	}
+
+	from := termenv.ConvertToRGB(termenv.TrueColor.Color(colors[i-1]))
+	to := termenv.ConvertToRGB(termenv.TrueColor.Color(colors[i]))
+
+	return from.BlendLab(to, position).Clamped().Hex()
+}
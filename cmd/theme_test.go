@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/muesli/termenv"
+	"github.com/spf13/viper"
+)
+
+// Returns the hex color of a theme color
+func hexColor(color string) string {
+	return termenv.ConvertToRGB(termenv.TrueColor.Color(color)).Hex()
+}
+
+func TestGradeOnSteps(t *testing.T) {
+	defer func(p termenv.Profile) { profile = p }(profile)
+
+	for _, name := range []string{"default", "mono"} {
+		th := builtinThemes[name]
+
+		for _, grades := range []struct {
+			steps  []int64
+			colors []string
+		}{
+			{th.SizeSteps, th.Dark.Size},
+			{th.AgeSteps, th.Dark.Age},
+			{th.SizeSteps, th.Light.Size},
+			{th.AgeSteps, th.Light.Age},
+		} {
+			for _, step := range grades.steps {
+				profile = termenv.ANSI256
+				discrete := grade(step, grades.steps, grades.colors)
+				profile = termenv.TrueColor
+				blended := grade(step, grades.steps, grades.colors)
+
+				if hexColor(blended) != hexColor(discrete) {
+					t.Errorf("%s theme: step %d is %s in truecolor, %s otherwise", name, step, hexColor(blended), hexColor(discrete))
+				}
+			}
+		}
+	}
+}
+
+func TestGradeBlend(t *testing.T) {
+	defer func(p termenv.Profile) { profile = p }(profile)
+	profile = termenv.TrueColor
+
+	steps := []int64{10, 1000}
+	colors := []string{"#000000", "#ffffff", "#ff0000"}
+
+	black := termenv.ConvertToRGB(termenv.TrueColor.Color("#000000"))
+	white := termenv.ConvertToRGB(termenv.TrueColor.Color("#ffffff"))
+
+	tests := []struct {
+		value int64
+		want  string
+	}{
+		{0, "#000000"},
+		{10, "#000000"},
+		// Halfway on a logarithmic scale
+		{100, black.BlendLab(white, 0.5).Clamped().Hex()},
+		{1000, "#ffffff"},
+		{1001, "#ff0000"},
+	}
+
+	for _, tt := range tests {
+		if got := hexColor(grade(tt.value, steps, colors)); got != tt.want {
+			t.Errorf("grade(%d) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+// Reads 'config' as the ~/.k config file for the test
+func setConfig(t *testing.T, config string) {
+	t.Helper()
+
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { viper.ReadConfig(strings.NewReader("")) })
+}
+
+func TestFindTheme(t *testing.T) {
+	setConfig(t, `
+themes:
+  mine:
+    extends: mono
+    size-steps: [4096, 1048576]
+    signs:
+      conflict: "!"
+    dark:
+      size: ["28", "142", "160"]
+      owner: "244"
+  child:
+    extends: mine
+    dark:
+      vcs:
+        modified: "#ff0000"
+  plain:
+    age-steps: [60]
+  default:
+    signs:
+      untracked: "?"
+  loop-a:
+    extends: loop-b
+  loop-b:
+    extends: loop-a
+  self:
+    extends: self
+  broken:
+    extends: missing
+`)
+
+	mono := builtinThemes["mono"]
+	def := builtinThemes["default"]
+
+	tests := []struct {
+		name  string
+		check func(th Theme) bool
+	}{
+		// Lists replace the ones of the base theme, maps are merged
+		{"mine", func(th Theme) bool {
+			return reflect.DeepEqual(th.SizeSteps, []int64{4096, 1048576}) &&
+				reflect.DeepEqual(th.Dark.Size, []string{"28", "142", "160"}) &&
+				th.Dark.Owner == "244" &&
+				th.Signs["conflict"] == "!" &&
+				th.Signs["untracked"] == mono.Signs["untracked"] &&
+				reflect.DeepEqual(th.AgeSteps, mono.AgeSteps) &&
+				reflect.DeepEqual(th.Light.Size, mono.Light.Size)
+		}},
+		{"child", func(th Theme) bool {
+			return th.Dark.VCS["modified"] == "#ff0000" &&
+				th.Dark.VCS["staged"] == mono.Dark.VCS["staged"] &&
+				th.Signs["conflict"] == "!" &&
+				reflect.DeepEqual(th.SizeSteps, []int64{4096, 1048576})
+		}},
+		// Extends "default" when unset
+		{"plain", func(th Theme) bool {
+			return reflect.DeepEqual(th.AgeSteps, []int64{60}) &&
+				reflect.DeepEqual(th.SizeSteps, def.SizeSteps)
+		}},
+		// Named like a built-in theme: overrides it
+		{"default", func(th Theme) bool {
+			return th.Signs["untracked"] == "?" && th.Signs["conflict"] == def.Signs["conflict"]
+		}},
+		{"mono", func(th Theme) bool {
+			return reflect.DeepEqual(th, mono)
+		}},
+	}
+
+	for _, tt := range tests {
+		th, err := findTheme(tt.name, map[string]bool{})
+		if err != nil {
+			t.Errorf("findTheme(%s): %v", tt.name, err)
+			continue
+		}
+
+		if !tt.check(th) {
+			t.Errorf("findTheme(%s) = %+v", tt.name, th)
+		}
+	}
+
+	// The built-in themes are left untouched
+	if !reflect.DeepEqual(builtinThemes["mono"].SizeSteps, mono.SizeSteps) || builtinThemes["mono"].Signs["conflict"] == "!" {
+		t.Error("a user theme changed the built-in theme it extends")
+	}
+
+	for _, name := range []string{"loop-a", "self", "broken", "unknown"} {
+		if _, err := findTheme(name, map[string]bool{}); err == nil {
+			t.Errorf("findTheme(%s) returned no error", name)
+		}
+	}
+}
+
+func TestValidateTheme(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(th *Theme)
+		valid  bool
+	}{
+		{"default", func(th *Theme) {}, true},
+		{"hex colors", func(th *Theme) { th.Dark.Owner = "#ff8700"; th.Light.Diff["added"] = "#abc" }, true},
+		{"steps not increasing", func(th *Theme) { th.SizeSteps[1] = th.SizeSteps[0] - 1 }, false},
+		{"missing size color", func(th *Theme) { th.Dark.Size = th.Dark.Size[1:] }, false},
+		{"extra age color", func(th *Theme) { th.Light.Age = append(th.Light.Age, "1") }, false},
+		{"color index", func(th *Theme) { th.Dark.VCS["modified"] = "256" }, false},
+		{"color name", func(th *Theme) { th.Light.Tracking["ahead"] = "red" }, false},
+		{"hex color", func(th *Theme) { th.Dark.History["hash"] = "#ggg" }, false},
+	}
+
+	for _, tt := range tests {
+		th := builtinThemes["default"].clone()
+		tt.change(&th)
+
+		if err := th.validate(tt.name); (err == nil) != tt.valid {
+			t.Errorf("%s: validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+
+	for name, th := range builtinThemes {
+		if err := th.validate(name); err != nil {
+			t.Errorf("built-in theme: %v", err)
+		}
+	}
+}
+
+func TestLoadBackground(t *testing.T) {
+	defer func(dark, colors bool) { isDarkBackground, colorOutput = dark, colors }(isDarkBackground, colorOutput)
+	colorOutput = false
+
+	tests := []struct {
+		background string
+		colorfgbg  string
+		dark       bool
+		err        bool
+	}{
+		{"dark", "0;15", true, false},
+		{"light", "15;0", false, false},
+		{"auto", "15;0", true, false},
+		{"", "0;15", false, false},
+		{"", "0;default;7", false, false},
+		{"", "15;default;8", true, false},
+		{"", "7;1", true, false},
+		{"", "0;12", false, false},
+		{"", "default;default", true, false},
+		// Without $COLORFGBG, the terminal isn't asked
+		// when the output is not colored
+		{"", "", true, false},
+		{"black", "", true, true},
+	}
+
+	for _, tt := range tests {
+		setConfig(t, fmt.Sprintf("background: %q", tt.background))
+		t.Setenv("COLORFGBG", tt.colorfgbg)
+		isDarkBackground = !tt.dark
+
+		err := loadBackground()
+		if (err != nil) != tt.err {
+			t.Errorf("background %q, COLORFGBG %q: error %v", tt.background, tt.colorfgbg, err)
+		}
+		if err == nil && isDarkBackground != tt.dark {
+			t.Errorf("background %q, COLORFGBG %q: dark %v, want %v", tt.background, tt.colorfgbg, isDarkBackground, tt.dark)
+		}
+	}
+}
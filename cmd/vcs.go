@@ -0,0 +1,648 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+
+	"github.com/gaelph/k/internal/git"
+)
+
+// Returns the Git status for a file
+// 'statuses' is nil when the listed directory
+// is not inside a work tree
+// 'repos' describes the repositories of the listing
+func vcsSatus(fd FileDscr, statuses *git.Statuses, repos map[string]*git.Repo) (string, *git.Repo) {
+	if *noVCS {
+		return "", nil
+	}
+
+	if fd.isGhost() {
+		if statuses == nil {
+			return "--", nil
+		}
+		if fd.ghostDir {
+			// Everything it contained is deleted, only
+			// whether the deletions are staged matters
+			status := []byte(statuses.DirectoryStatus(fd.fullpath))
+			for i, c := range status {
+				if c != ' ' {
+					status[i] = 'D'
+				}
+			}
+
+			return string(status), nil
+		}
+
+		return statuses.FileStatus(fd.fullpath), nil
+	}
+
+	if fd.revEntry != nil {
+		return "--", revSubmodule(fd)
+	}
+
+	return git.Status(fd.fullpath, fd.fileInfo, statuses, repos)
+}
+
+// Describes the repositories and submodules of the
+// listing, all at once, keyed by path
+func loadRepos(descriptors []FileDscr, statuses *git.Statuses) map[string]*git.Repo {
+	if *noVCS {
+		return nil
+	}
+
+	dirs := []string{}
+	for _, d := range descriptors {
+		if !d.isGhost() && d.revEntry == nil && d.isDir() {
+			dirs = append(dirs, d.fullpath)
+		}
+	}
+
+	return git.LoadRepos(dirs, statuses)
+}
+
+// Returns the status of an entry, without looking
+// into the repositories it may contain
+func entryStatus(fullpath string, isDir bool, statuses *git.Statuses) string {
+	if isDir {
+		return statuses.DirectoryStatus(fullpath)
+	}
+
+	return statuses.FileStatus(fullpath)
+}
+
+// Returns true if an entry is ignored by git and ignored
+// entries are hidden, unless -a or -A is set
+func hideIgnored(fullpath string, isDir bool, statuses *git.Statuses) bool {
+	if statuses == nil || !viper.GetBool("git-ignore") || *listAll || *listAlmostAll {
+		return false
+	}
+
+	return entryStatus(fullpath, isDir, statuses) == "!!"
+}
+
+// Filters of the listing by git state
+func isModified(status string) bool {
+	return !git.IsConflict(status) && status[1] != ' ' && status[1] != '?' && status[1] != '!'
+}
+
+func isStaged(status string) bool {
+	return !git.IsConflict(status) && status[0] != ' ' && status[0] != '?' && status[0] != '!'
+}
+
+func isUntracked(status string) bool {
+	return status == "??"
+}
+
+// Returns true if an entry, or one of the entries it contains,
+// matches one of the git state filters (--modified, --staged…)
+// Entries are not filtered when no filter is set
+func matchesGitFilters(fullpath string, statuses *git.Statuses) bool {
+	filters := []func(string) bool{}
+
+	if *filterModified {
+		filters = append(filters, isModified)
+	}
+	if *filterStaged {
+		filters = append(filters, isStaged)
+	}
+	if *filterUntracked {
+		filters = append(filters, isUntracked)
+	}
+	if *filterConflicted {
+		filters = append(filters, git.IsConflict)
+	}
+
+	if len(filters) == 0 {
+		return true
+	}
+
+	// Nothing is pending outside of a work tree
+	if statuses == nil {
+		return false
+	}
+
+	return statuses.AnyStatus(fullpath, func(status string) bool {
+		if len(status) != 2 {
+			return false
+		}
+
+		for _, filter := range filters {
+			if filter(status) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// Ranks of the git states when sorting by git status
+const (
+	rankConflicted = iota
+	rankStaged
+	rankModified
+	rankUntracked
+	rankClean
+	rankIgnored
+)
+
+// Returns the rank of an entry when sorting by git status,
+// directories ranking like the entries they contain
+func gitRank(fd FileDscr, statuses *git.Statuses) int {
+	if statuses == nil || fd.revEntry != nil {
+		return rankClean
+	}
+
+	// Visits each code once, keeping the best rank
+	rank := rankClean
+	statuses.AnyStatus(fd.fullpath, func(status string) bool {
+		rank = min(rank, statusRank(status))
+		return rank == rankConflicted
+	})
+
+	if rank == rankClean && entryStatus(fd.fullpath, fd.isDir(), statuses) == "!!" {
+		return rankIgnored
+	}
+
+	return rank
+}
+
+// Returns the rank of an XY code when sorting by git status
+// Ignored paths rank like clean ones
+func statusRank(status string) int {
+	switch {
+	case git.IsConflict(status):
+		return rankConflicted
+	case isStaged(status):
+		return rankStaged
+	case isModified(status):
+		return rankModified
+	case isUntracked(status):
+		return rankUntracked
+	}
+
+	return rankClean
+}
+
+// Returns whether a line should be printed for an
+// entry according to its git state and the flags
+func shouldPrintStatus(fullpath string, isDir bool, statuses *git.Statuses) bool {
+	return !hideIgnored(fullpath, isDir, statuses) && matchesGitFilters(fullpath, statuses)
+}
+
+// Renders a whole row with the color of ignored entries
+func dimRow(elemts []string) []string {
+	color := palette().VCS["ignored"]
+
+	dimmed := make([]string, len(elemts))
+	for i, e := range elemts {
+		dimmed[i] = paint(color, stripColors(e))
+	}
+
+	return dimmed
+}
+
+var colorEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Removes the color escape sequences of a string
+func stripColors(s string) string {
+	return colorEscape.ReplaceAllString(s, "")
+}
+
+// Returns the descriptors of the tracked entries deleted
+// from the work tree, that os.ReadDir doesn't return
+func ghostDescriptors(cwd string, statuses *git.Statuses) []FileDscr {
+	ghosts := []FileDscr{}
+	if statuses == nil {
+		return ghosts
+	}
+
+	for name, isDir := range statuses.Deleted() {
+		fullpath := path.Join(cwd, name)
+
+		if _, err := os.Lstat(fullpath); err == nil {
+			continue
+		}
+
+		if shouldPrint(name, isDir) && shouldPrintStatus(fullpath, isDir, statuses) {
+			ghosts = append(ghosts, FileDscr{
+				name:     name,
+				fullpath: fullpath,
+				ghostDir: isDir,
+			})
+		}
+	}
+
+	return ghosts
+}
+
+// Placeholders for the columns of a ghost,
+// like `ls` does for entries it can't stat
+func ghostElements(fd FileDscr) []string {
+	mode := "-?????????"
+	if fd.ghostDir {
+		mode = "d?????????"
+	}
+
+	return []string{mode, "?", "?", "?", "?", "?"}
+}
+
+// Styles of VCS status markers
+const (
+	// One colored sign per entry
+	vcsStyleMarker = "marker"
+	// Two glyphs, for the index and the work tree,
+	// like `git status --short`
+	vcsStyleXY = "xy"
+)
+
+var letterNames = map[byte]string{
+	'M': "modified",
+	'T': "typechange",
+	'A': "added",
+	'D': "deleted",
+	'R': "renamed",
+	'C': "copied",
+	'U': "unmerged",
+	'?': "untracked",
+	'!': "ignored",
+}
+
+// States colored by letters of the index column
+var indexStates = map[byte]string{
+	'M': "staged",
+	'T': "staged-typechange",
+	'A': "added",
+	'D': "staged-deleted",
+	'R': "renamed",
+	'C': "copied",
+	'?': "untracked",
+	'!': "ignored",
+}
+
+// States colored by letters of the work tree column
+var workTreeStates = map[byte]string{
+	'M': "modified",
+	'T': "typechange",
+	'A': "intent-to-add",
+	'D': "deleted",
+	'?': "untracked",
+	'!': "ignored",
+}
+
+// Returns the name of the state described by
+// a porcelain XY code
+func vcsState(status string) string {
+	switch {
+	case status == "DG":
+		return "repo-clean"
+	case status == "??":
+		return "untracked"
+	case status == "!!":
+		return "ignored"
+	case git.IsConflict(status):
+		return "conflict"
+	case len(status) != 2:
+		return "default"
+	}
+
+	index, inIndex := indexStates[status[0]]
+	workTree, inWorkTree := workTreeStates[status[1]]
+
+	switch {
+	case inIndex && inWorkTree:
+		// Changed in both, "added+modified"
+		return index + "+" + workTree
+	case inIndex:
+		return index
+	case inWorkTree:
+		return workTree
+	}
+
+	return "default"
+}
+
+// Overrides the VCS signs, glyphs and colors
+// with the ones from the config file:
+//
+//	vcs:
+//	  style: xy
+//	  signs:
+//	    conflict: "!"
+//	  glyphs:
+//	    untracked: "N"
+//	  colors:
+//	    dark:
+//	      modified: 160
+//	    light:
+//	      modified: 124
+//
+// The theme is loaded first, these override it
+func loadVCSConfig() {
+	for state, sign := range viper.GetStringMapString("vcs.signs") {
+		theme.Signs[state] = sign
+	}
+
+	for letter, glyph := range viper.GetStringMapString("vcs.glyphs") {
+		theme.Glyphs[letter] = glyph
+	}
+
+	for state, color := range viper.GetStringMap("vcs.colors.dark") {
+		theme.Dark.VCS[state] = cast.ToString(color)
+	}
+
+	for state, color := range viper.GetStringMap("vcs.colors.light") {
+		theme.Light.VCS[state] = cast.ToString(color)
+	}
+}
+
+// Formats the branch of a repository, followed by
+// the operation in progress, its position relative
+// to its upstream and the number of stashes
+// Only local refs are used, nothing is fetched
+//
+//	main ↑2↓1         -> 2 commits to push, 1 to pull
+//	main ⊘            -> the upstream branch is gone
+//	main ∅            -> the branch has no upstream
+//	main|REBASE 3/7   -> rebasing, at commit 3 out of 7
+//	main ≡2           -> 2 stash entries
+//	wt:name feat      -> linked worktree "name", on branch feat
+//	sub:main ≠        -> submodule, not at the recorded commit
+func formatRepo(repo *git.Repo) string {
+	if repo == nil {
+		return ""
+	}
+
+	colors := palette().Tracking
+	signsTracking := theme.TrackingSigns
+
+	tracking := ""
+	switch {
+	case repo.Detached:
+		// Not on a branch, nothing to track
+	case repo.Upstream == "":
+		tracking = paint(colors["none"], signsTracking["none"])
+	case repo.UpstreamGone:
+		tracking = paint(colors["gone"], signsTracking["gone"])
+	default:
+		if repo.Ahead > 0 {
+			tracking += paint(colors["ahead"], fmt.Sprint(signsTracking["ahead"], repo.Ahead))
+		}
+		if repo.Behind > 0 {
+			tracking += paint(colors["behind"], fmt.Sprint(signsTracking["behind"], repo.Behind))
+		}
+	}
+
+	result := paint(branchColor, repo.Branch)
+
+	switch repo.Kind {
+	case git.RepoWorktree:
+		result = paint(colors["kind"], "wt:"+repo.Worktree) + " " + result
+	case git.RepoSubmodule:
+		result = paint(colors["kind"], "sub:") + result
+		if !repo.AtRecordedCommit {
+			result += " " + paint(colors["moved"], signsTracking["moved"])
+		}
+	}
+
+	if repo.Operation != "" {
+		operation := "|" + repo.Operation
+		if repo.Total > 0 {
+			operation += fmt.Sprintf(" %d/%d", repo.Step, repo.Total)
+		}
+
+		result += colored(colors["operation"]).Bold().Styled(operation)
+	}
+
+	if tracking != "" {
+		result += " " + tracking
+	}
+
+	if repo.Stashes > 0 {
+		result += " " + paint(colors["stash"], fmt.Sprint(signsTracking["stash"], repo.Stashes))
+	}
+
+	return result
+}
+
+func hasKey[K comparable, V any](m map[K]V, key K) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// Colors the VCS status marker
+func formatVCSStatus(status string) string {
+	if *noVCS {
+		return ""
+	}
+
+	xy := viper.GetString("vcs.style") == vcsStyleXY
+
+	if status == "--" {
+		if xy {
+			return "  "
+		}
+		return " "
+	}
+
+	colors := palette().VCS
+
+	state := vcsState(status)
+
+	if xy && len(status) == 2 && state != "repo-clean" {
+		return formatXYStatus(status, colors)
+	}
+
+	if !hasKey(colors, state) || !hasKey(theme.Signs, state) {
+		// Themes may only have a state for the index
+		// change of entries changed in both
+		state, _, _ = strings.Cut(state, "+")
+	}
+
+	if !hasKey(colors, state) || !hasKey(theme.Signs, state) {
+		state = "default"
+	}
+
+	style := colored(colors[state])
+	if state == "conflict" {
+		style = style.Bold()
+	}
+	marker := style.Styled(theme.Signs[state])
+
+	if xy {
+		return marker + " "
+	}
+
+	return marker
+}
+
+// Formats a porcelain XY code as two colored glyphs,
+// one for the index and one for the work tree
+func formatXYStatus(status string, colors map[string]string) string {
+	conflict := git.IsConflict(status)
+	var b strings.Builder
+
+	for i, states := range []map[byte]string{indexStates, workTreeStates} {
+		letter := status[i]
+
+		if letter == ' ' {
+			b.WriteString(" ")
+			continue
+		}
+
+		glyph, ok := theme.Glyphs[letterNames[letter]]
+		if !ok {
+			glyph = string(letter)
+		}
+
+		if conflict {
+			b.WriteString(colored(colors["conflict"]).Bold().Styled(glyph))
+			continue
+		}
+
+		color, ok := colors[states[letter]]
+		if !ok {
+			color = colors["default"]
+		}
+
+		b.WriteString(paint(color, glyph))
+	}
+
+	return b.String()
+}
+
+// Returns the names of the entries git may know about,
+// the ones the history walk has to find
+func trackedNames(descriptors []FileDscr, statuses *git.Statuses) []string {
+	names := []string{}
+
+	for _, d := range descriptors {
+		if d.name == "." || d.name == ".." {
+			continue
+		}
+
+		if status := entryStatus(d.fullpath, d.isDir(), statuses); status != "??" && status != "!!" {
+			names = append(names, d.name)
+		}
+	}
+
+	return names
+}
+
+// commitFileInfo dates an entry with its last commit
+type commitFileInfo struct {
+	os.FileInfo
+	commitTime time.Time
+}
+
+func (fi commitFileInfo) ModTime() time.Time {
+	return fi.commitTime
+}
+
+// Dates the entries with their last commit, the
+// ones without commits keeping their mtime
+func withCommitTimes(descriptors []FileDscr, history *git.History) []FileDscr {
+	for i, d := range descriptors {
+		if d.isGhost() {
+			continue
+		}
+
+		if c := history.LastCommit(d.fullpath); c != nil {
+			descriptors[i].fileInfo = commitFileInfo{d.fileInfo, c.Time}
+		}
+	}
+
+	return descriptors
+}
+
+// Formats the last commit of an entry as three columns:
+// abbreviated hash, author and age
+// The columns are empty for entries without commits
+func formatLastCommit(c *git.Commit) []string {
+	if c == nil {
+		return []string{"", "", ""}
+	}
+
+	colors := palette().History
+
+	return []string{
+		paint(colors["hash"], c.Hash),
+		formatUsername(c.Author),
+		paint(timeColor(c.Time), relativeTime(c.Time)),
+	}
+}
+
+// Returns how long ago 't' was, like "3 days ago"
+func relativeTime(t time.Time) string {
+	secs := time.Now().Unix() - t.Unix()
+
+	units := []struct {
+		name    string
+		seconds int64
+	}{
+		{"year", 31536000},
+		{"month", 2592000},
+		{"week", 604800},
+		{"day", 86400},
+		{"hour", 3600},
+		{"minute", 60},
+	}
+
+	for _, unit := range units {
+		if n := secs / unit.seconds; n >= 1 {
+			if n == 1 {
+				return "1 " + unit.name + " ago"
+			}
+
+			return fmt.Sprintf("%d %ss ago", n, unit.name)
+		}
+	}
+
+	if secs < 0 {
+		return "in the future"
+	}
+
+	return "just now"
+}
+
+// Formats the lines added and removed in a file, or in
+// a directory, as two columns colored like `git diff --stat`
+// The columns are empty when there are no changes
+func formatDiffStat(stat git.DiffStat, changed bool) []string {
+	if !changed {
+		return []string{"", ""}
+	}
+
+	if stat.Binary && stat.Added == 0 && stat.Removed == 0 {
+		return []string{"bin", ""}
+	}
+
+	colors := palette().Diff
+
+	return []string{
+		paint(colors["added"], fmt.Sprint("+", stat.Added)),
+		paint(colors["removed"], fmt.Sprint("-", stat.Removed)),
+	}
+}
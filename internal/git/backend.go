@@ -0,0 +1,194 @@
+package git
+
+// Selection of the way git information is collected
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// Returned by the native backend for anything it can't
+// handle, in which case the exec backend takes over
+var errUnsupported = errors.New("not supported by the native git backend")
+
+// Backend collects git information for a listing
+type Backend interface {
+	// Collects the status of every entry below 'dir',
+	// ignored ones included if 'ignored' is true
+	Statuses(dir string, ignored bool) (*Statuses, error)
+	// Describes the repository at 'dir'
+	Repo(dir string) (*Repo, error)
+	// Finds the last commit touching 'dir' and its entries
+	// in the history of 'rev' ("" for HEAD)
+	History(dir string, rev string, names []string) (*History, error)
+	// Counts the lines changed in the files below 'dir'
+	DiffStats(dir string) (*DiffStats, error)
+	// Lists 'dir' as of the revision 'rev'
+	Revision(dir string, rev string) (*Revision, error)
+	// Returns the URL of the remote of the repository at 'dir'
+	RemoteURL(dir string) (string, error)
+}
+
+// Backends, as selected by SetBackend
+const (
+	// Native when git is not installed, exec otherwise
+	BackendAuto = "auto"
+	// Shell out to the git binary
+	BackendExec = "exec"
+	// Read the repository files directly,
+	// falling back to exec when needed
+	BackendNative = "native"
+)
+
+var backend Backend = execBackend{}
+
+// Whether git is on the PATH, the native backend
+// can only hand over to the exec backend if it is
+var gitInstalled = true
+
+// SetBackend selects how git information is collected,
+// one of "auto", "exec" or "native"
+func SetBackend(name string) error {
+	_, err := exec.LookPath("git")
+	gitInstalled = err == nil
+
+	switch name {
+	case BackendAuto, "":
+		if gitInstalled {
+			backend = execBackend{}
+		} else {
+			backend = nativeBackend{}
+		}
+	case BackendExec:
+		backend = execBackend{}
+	case BackendNative:
+		backend = nativeBackend{}
+	default:
+		return fmt.Errorf("unknown git backend %q (expected auto, exec or native)", name)
+	}
+
+	return nil
+}
+
+// execBackend runs the git binary
+type execBackend struct{}
+
+func (execBackend) Statuses(dir string, ignored bool) (*Statuses, error) {
+	ok, _, prefix := TopLevel(dir)
+	if !ok {
+		return nil, errNotInWorkTree
+	}
+
+	args := []string{"status", "--porcelain=v2", "-z", "--untracked-files=normal"}
+	if ignored {
+		args = append(args, "--ignored")
+	}
+
+	out, err := run(dir, append(args, "--", ".")...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStatuses(dir, prefix, parsePorcelain(out)), nil
+}
+
+func (execBackend) Repo(dir string) (*Repo, error) {
+	out, err := runRepo(dir, "status", "--porcelain=v2", "-z", "--branch", "--untracked-files=no", "--ignore-submodules")
+	if err != nil {
+		return nil, err
+	}
+
+	p := parsePorcelain(out)
+
+	repo := &Repo{Status: "DG"}
+	repo.parseBranchHeaders(p.headers)
+
+	if len(p.entries) > 0 {
+		repo.Status = " M"
+	}
+
+	return repo, nil
+}
+
+func (execBackend) History(dir string, rev string, names []string) (*History, error) {
+	return execHistory(dir, rev, names)
+}
+
+func (execBackend) DiffStats(dir string) (*DiffStats, error) {
+	return execDiffStats(dir)
+}
+
+func (execBackend) Revision(dir string, rev string) (*Revision, error) {
+	return execRevision(dir, rev)
+}
+
+func (execBackend) RemoteURL(dir string) (string, error) {
+	return execRemoteURL(dir)
+}
+
+// nativeBackend reads the repository files,
+// and hands over to the exec backend for the
+// repositories it can't handle
+type nativeBackend struct{}
+
+func (nativeBackend) Statuses(dir string, ignored bool) (*Statuses, error) {
+	statuses, err := nativeStatuses(dir, ignored)
+
+	return handOver(statuses, err, func() (*Statuses, error) {
+		return execBackend{}.Statuses(dir, ignored)
+	})
+}
+
+func (nativeBackend) Repo(dir string) (*Repo, error) {
+	repo, err := nativeRepo(dir)
+
+	return handOver(repo, err, func() (*Repo, error) {
+		return execBackend{}.Repo(dir)
+	})
+}
+
+func (nativeBackend) History(dir string, rev string, names []string) (*History, error) {
+	history, err := nativeHistory(dir, rev, names)
+
+	return handOver(history, err, func() (*History, error) {
+		return execBackend{}.History(dir, rev, names)
+	})
+}
+
+// Counting lines needs a diff implementation,
+// git is always run for it
+func (nativeBackend) DiffStats(dir string) (*DiffStats, error) {
+	return execBackend{}.DiffStats(dir)
+}
+
+func (nativeBackend) Revision(dir string, rev string) (*Revision, error) {
+	revision, err := nativeRevision(dir, rev)
+
+	return handOver(revision, err, func() (*Revision, error) {
+		return execBackend{}.Revision(dir, rev)
+	})
+}
+
+func (nativeBackend) RemoteURL(dir string) (string, error) {
+	url, err := nativeRemoteURL(dir)
+
+	return handOver(url, err, func() (string, error) {
+		return execBackend{}.RemoteURL(dir)
+	})
+}
+
+// Returns what the exec backend returns when the native backend
+// returned errUnsupported, and git is installed, 'value' and
+// 'err' otherwise
+func handOver[T any](value T, err error, fallback func() (T, error)) (T, error) {
+	if !errors.Is(err, errUnsupported) {
+		return value, err
+	}
+
+	if !gitInstalled {
+		return value, fmt.Errorf("%w, and git is not installed", err)
+	}
+
+	return fallback()
+}
@@ -0,0 +1,233 @@
+package git
+
+// Minimal reader for git configuration files
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// config holds the values of git configuration files,
+// keyed by "section.key" or "section.subsection.key"
+// Section and key names are lower cased
+type config map[string]string
+
+// Reads a git configuration file and merges its values
+// into 'c'. Missing files are silently ignored
+func (c config) load(filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := trimAllSpaces(scanner.Text())
+
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			name, rest, ok := parseConfigSection(line)
+			if !ok {
+				continue
+			}
+
+			section = name
+
+			// A variable can follow the header on the same line
+			line = trimAllSpaces(rest)
+			if line == "" || line[0] == '#' || line[0] == ';' {
+				continue
+			}
+		}
+
+		key, raw, hasValue := strings.Cut(line, "=")
+		if !hasValue {
+			// A key without a value is a boolean set to true
+			raw = "true"
+		}
+
+		value, continued := parseConfigValue(raw)
+		for continued && scanner.Scan() {
+			raw += "\n" + scanner.Text()
+			value, continued = parseConfigValue(raw)
+		}
+
+		c[section+"."+strings.ToLower(trimAllSpaces(key))] = value
+	}
+}
+
+// Parses a section header: "[section]", "[section "subsection"]"
+// or the older "[section.subsection]"
+// Returns the "section" or "section.subsection" prefix of
+// keys and what follows the header on the line
+// Only subsections in quotes are case sensitive
+func parseConfigSection(line string) (string, string, bool) {
+	end := strings.IndexAny(line, " \t]")
+	if end < 0 {
+		return "", "", false
+	}
+
+	section := strings.ToLower(line[1:end])
+
+	rest := strings.TrimLeft(line[end:], " \t")
+	if rest == "" {
+		return "", "", false
+	}
+
+	if rest[0] == ']' {
+		return section, rest[1:], true
+	}
+
+	if rest[0] != '"' {
+		return "", "", false
+	}
+
+	var sub strings.Builder
+
+	for i := 1; i < len(rest); i++ {
+		switch rest[i] {
+		case '\\':
+			if i+1 < len(rest) {
+				i++
+				sub.WriteByte(rest[i])
+			}
+		case '"':
+			if i+1 >= len(rest) || rest[i+1] != ']' {
+				return "", "", false
+			}
+
+			return section + "." + sub.String(), rest[i+2:], true
+		default:
+			sub.WriteByte(rest[i])
+		}
+	}
+
+	return "", "", false
+}
+
+// Strips comments and quotes from a configuration value,
+// and unescapes it
+// Like git, whitespace is only kept inside quotes, or between
+// words where runs of spaces and tabs become spaces
+// Returns true if the value ends with a backslash, to be
+// continued on the next line
+func parseConfigValue(value string) (string, bool) {
+	var b strings.Builder
+	quoted := false
+	spaces := 0
+
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+
+		if !quoted {
+			if ch == ' ' || ch == '\t' || ch == '\r' {
+				if b.Len() > 0 {
+					spaces++
+				}
+				continue
+			}
+
+			if ch == '#' || ch == ';' {
+				break
+			}
+		}
+
+		for ; spaces > 0; spaces-- {
+			b.WriteByte(' ')
+		}
+
+		switch {
+		case ch == '"':
+			quoted = !quoted
+		case ch == '\\' && i+1 == len(value):
+			return b.String(), true
+		case ch == '\\':
+			i++
+			switch value[i] {
+			case '\n':
+				// Continuation line
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'b':
+				b.WriteByte('\b')
+			default:
+				b.WriteByte(value[i])
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return b.String(), false
+}
+
+// Returns a configuration value, or 'def' if it is not set
+func (c config) get(key string, def string) string {
+	if value, ok := c[key]; ok {
+		return value
+	}
+
+	return def
+}
+
+// Returns a boolean configuration value, or 'def' if it is not set
+func (c config) bool(key string, def bool) bool {
+	value, ok := c[key]
+	if !ok {
+		return def
+	}
+
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true
+	case "false", "no", "off", "0", "":
+		return false
+	}
+
+	return def
+}
+
+// Returns the path of the user's global git configuration
+// files, in the order git reads them
+func globalConfigFiles() []string {
+	files := []string{}
+
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	home, err := homedir.Dir()
+
+	if xdg == "" && err == nil {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	if xdg != "" {
+		files = append(files, filepath.Join(xdg, "git", "config"))
+	}
+
+	if err == nil {
+		files = append(files, filepath.Join(home, ".gitconfig"))
+	}
+
+	return files
+}
+
+// Expands a leading "~/" in a path read from the configuration
+func expandHome(p string) string {
+	expanded, err := homedir.Expand(p)
+	if err != nil {
+		return p
+	}
+
+	return expanded
+}
@@ -0,0 +1,119 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigValue(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      string
+		continued bool
+	}{
+		{"plain", "plain", false},
+		{"  padded  ", "padded", false},
+		{"two  words", "two  words", false},
+		{"tab\tseparated", "tab separated", false},
+		{`"quoted"`, "quoted", false},
+		{`" kept spaces "`, " kept spaces ", false},
+		{`half" quoted "value`, "half quoted value", false},
+		{`"# not a comment"`, "# not a comment", false},
+		{"value # comment", "value", false},
+		{"value ; comment", "value", false},
+		{`a\"b`, `a"b`, false},
+		{`a\\b`, `a\b`, false},
+		{`line\nbreak`, "line\nbreak", false},
+		{`tab\tescape`, "tab\tescape", false},
+		{`back\bspace`, "back\bspace", false},
+		{`""`, "", false},
+		{"", "", false},
+		{`continued \`, "continued ", true},
+		{"continued \\\n  here", "continued   here", false},
+		{`"in quotes \`, "in quotes ", true},
+		{`escaped \\`, `escaped \`, false},
+		{`comment ; \`, "comment", false},
+	}
+
+	for _, tt := range tests {
+		got, continued := parseConfigValue(tt.value)
+		if got != tt.want || continued != tt.continued {
+			t.Errorf("parseConfigValue(%q) = %q, %v, want %q, %v", tt.value, got, continued, tt.want, tt.continued)
+		}
+	}
+}
+
+// Lists the values of a configuration file with `git config --list`
+func gitConfigList(t *testing.T, dir string, filename string) config {
+	t.Helper()
+
+	c := config{}
+	for _, entry := range strings.Split(runGit(t, dir, "config", "--file", filename, "--list", "-z"), "\x00") {
+		if entry == "" {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(entry, "\n")
+		if !hasValue {
+			value = "true"
+		}
+		c[key] = value
+	}
+
+	return c
+}
+
+func TestConfigLoad(t *testing.T) {
+	dir := newFixture(t)
+	filename := filepath.Join(dir, "test.config")
+
+	content := strings.Join([]string{
+		"# comment",
+		"; comment",
+		"[core]",
+		"\tBare = false",
+		"\tfileMode",
+		"\tautocrlf = input ; comment",
+		"[Remote \"Origin\"]",
+		"\turl = git@example.com:org/repo.git",
+		"\tfetch = +refs/heads/*:refs/remotes/Origin/*",
+		"[remote \"with \\\"quotes\\\" and \\\\\"]",
+		"\turl = quoted",
+		"[branch.Legacy]",
+		"\tremote = origin",
+		"[alias]",
+		"\tlong = log \\",
+		"\t  --oneline \\",
+		"--graph",
+		"\tquoted = \"  spaces  \"",
+		"\tescaped = \"a\\tb\\nc\"",
+		"\tsemicolon = \"x;y\" ; z",
+		"\tempty =",
+		"\tlast = one",
+		"\tlast = two",
+		"[section] inline = value",
+		"",
+	}, "\n")
+
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := gitConfigList(t, dir, filename)
+	got := config{}
+	got.load(filename)
+
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %q, want %q", key, got[key], value)
+		}
+	}
+
+	for key := range got {
+		if _, ok := want[key]; !ok {
+			t.Errorf("%s = %q, not set by git", key, got[key])
+		}
+	}
+}
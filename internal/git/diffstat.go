@@ -0,0 +1,113 @@
+package git
+
+// Lines added and removed by the pending changes
+
+import (
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DiffStat counts the lines added and removed in a file,
+// or in all the files below a directory
+type DiffStat struct {
+	Added   int
+	Removed int
+	// At least one of the files is binary,
+	// its lines are not counted
+	Binary bool
+}
+
+// DiffStats holds the diff stat of every changed file
+// below a directory, staged and unstaged changes together
+type DiffStats struct {
+	// Directory the stats were collected for
+	dir string
+	// Stats keyed by path relative to 'dir', with
+	// the totals of the directories ("." for 'dir')
+	stats map[string]DiffStat
+}
+
+// LoadDiffStats counts the lines added and removed in every
+// file below 'dir', with the selected backend
+func LoadDiffStats(dir string) (*DiffStats, error) {
+	return backend.DiffStats(dir)
+}
+
+// Runs `git diff HEAD --numstat`, for the staged and unstaged
+// changes at once, against the empty tree on an unborn branch
+func execDiffStats(dir string) (*DiffStats, error) {
+	d := &DiffStats{dir: dir, stats: make(map[string]DiffStat)}
+
+	base := "HEAD"
+	if _, err := run(dir, "rev-parse", "--verify", "-q", "HEAD"); err != nil {
+		// The id of the empty tree depends on the object format
+		out, err := run(dir, "hash-object", "-t", "tree", "--stdin")
+		if err != nil {
+			return nil, err
+		}
+
+		base = trimAllSpaces(string(out))
+	}
+
+	out, err := run(dir, "diff", "--numstat", "-z", "--relative", "--no-renames", base, "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	d.parseNumstat(string(out))
+
+	return d, nil
+}
+
+// Adds the stats of `git diff --numstat -z` output, made of
+// "<added>\t<removed>\t<path>\0" records, "-" counts
+// standing for binary files
+func (d *DiffStats) parseNumstat(out string) {
+	for _, record := range strings.Split(out, "\x00") {
+		fields := strings.SplitN(record, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		stat := DiffStat{}
+		if fields[0] == "-" {
+			stat.Binary = true
+		} else {
+			stat.Added, _ = strconv.Atoi(fields[0])
+			stat.Removed, _ = strconv.Atoi(fields[1])
+		}
+
+		// The file and the directories containing it,
+		// up to 'dir' itself (".")
+		for p := fields[2]; ; p = path.Dir(p) {
+			d.stats[p] = d.stats[p].add(stat)
+
+			if p == "." {
+				break
+			}
+		}
+	}
+}
+
+func (s DiffStat) add(other DiffStat) DiffStat {
+	return DiffStat{
+		Added:   s.Added + other.Added,
+		Removed: s.Removed + other.Removed,
+		Binary:  s.Binary || other.Binary,
+	}
+}
+
+// Returns the stat of a file, or the totals of a directory
+// The second return value is false if it has no changes
+func (d *DiffStats) Stat(fullpath string) (DiffStat, bool) {
+	rel, err := filepath.Rel(d.dir, fullpath)
+	if err != nil {
+		return DiffStat{}, false
+	}
+
+	stat, ok := d.stats[filepath.ToSlash(rel)]
+
+	return stat, ok
+}
@@ -0,0 +1,50 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffStats(t *testing.T) {
+	dir := newFixture(t)
+
+	// Unborn branch: the staged files count as added
+	writeFiles(t, dir, map[string]string{"a.txt": "one\ntwo\n"})
+	runGit(t, dir, "add", ".")
+
+	d, err := execDiffStats(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.Stat(filepath.Join(dir, "a.txt")); got != (DiffStat{Added: 2}) {
+		t.Errorf("unborn: a.txt = %+v, want 2 added", got)
+	}
+
+	runGit(t, dir, "commit", "-q", "-m", "first")
+
+	// The same line changed in the index, then in the work tree
+	writeFiles(t, dir, map[string]string{"a.txt": "one\nstaged\n", "dir/b.txt": "b\n"})
+	runGit(t, dir, "add", ".")
+	writeFiles(t, dir, map[string]string{"a.txt": "one\nunstaged\n"})
+
+	d, err = execDiffStats(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want DiffStat
+	}{
+		{"a.txt", DiffStat{Added: 1, Removed: 1}},
+		{"dir/b.txt", DiffStat{Added: 1}},
+		{"dir", DiffStat{Added: 1}},
+		{"", DiffStat{Added: 2, Removed: 1}},
+	}
+
+	for _, tt := range tests {
+		if got, _ := d.Stat(filepath.Join(dir, tt.path)); got != tt.want {
+			t.Errorf("%q = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
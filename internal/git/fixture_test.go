@@ -0,0 +1,114 @@
+package git
+
+// Repositories built with git for the tests
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Creates a repository in a temporary directory, with git
+// configured independently of the user running the tests
+// Skips the test when git is not installed
+func newFixture(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Ada")
+	t.Setenv("GIT_AUTHOR_EMAIL", "ada@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Ada")
+	t.Setenv("GIT_COMMITTER_EMAIL", "ada@example.com")
+	for _, name := range repoEnv {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q", "-b", "main")
+
+	return dir
+}
+
+// Runs git in 'dir' and returns its standard output,
+// failing the test if it fails
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	return runGitInput(t, dir, "", args...)
+}
+
+// Like runGit, writing 'input' to the standard input of git
+func runGitInput(t *testing.T, dir string, input string, args ...string) string {
+	t.Helper()
+
+	var stderr bytes.Buffer
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	c.Stdin = strings.NewReader(input)
+	c.Stderr = &stderr
+
+	out, err := c.Output()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+
+	return string(out)
+}
+
+// Writes files below 'dir', creating their directories
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Opens the repository of a fixture
+func openFixture(t *testing.T, dir string) *repository {
+	t.Helper()
+
+	r, _, err := findRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.close)
+
+	return r
+}
+
+// Commits what is staged, signed with a new SSH key
+// Skips the test when ssh-keygen is not installed
+func commitSigned(t *testing.T, dir string, message string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+
+	key := filepath.Join(t.TempDir(), "key")
+	c := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key)
+	if out, err := c.CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v\n%s", err, out)
+	}
+
+	runGit(t, dir, "-c", "gpg.format=ssh", "-c", "user.signingkey="+key, "commit", "-q", "-S", "-m", message)
+}
@@ -3,200 +3,219 @@ package git
 // Helper function for git status
 
 import (
-	"fmt"
+	"errors"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 )
 
+var errNotInWorkTree = errors.New("not in a git work tree")
+
 func trimAllSpaces(s string) string {
 	return strings.Trim(s, " \n\r\t\v\f")
 }
 
-// Returns true if th current working directory
-// is in a git work tree
-func IsInWorkTree() bool {
-	var err error
+// Runs git with 'args' from the directory 'dir'
+// and returns its standard output
+func run(dir string, args ...string) ([]byte, error) {
+	c := exec.Command("git", args...)
+	c.Dir = dir
 
-	s, err := exec.Command("git", "rev-parse", "--is-inside-work-tree").Output()
+	return c.Output()
+}
 
-	if err != nil {
-		return false
+// Returns true if 'err' is git exiting with 'status'
+func isExitStatus(err error, status int) bool {
+	var exitErr *exec.ExitError
+
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == status
+}
+
+// Environment variables that make git use another
+// repository than the one found from its working directory
+var repoEnv = []string{
+	"GIT_DIR",
+	"GIT_WORK_TREE",
+	"GIT_COMMON_DIR",
+	"GIT_INDEX_FILE",
+	"GIT_OBJECT_DIRECTORY",
+	"GIT_ALTERNATE_OBJECT_DIRECTORIES",
+	"GIT_NAMESPACE",
+	"GIT_CEILING_DIRECTORIES",
+}
+
+// Like run, for the repository whose top level is 'dir',
+// even if the user points git to another one
+// with GIT_DIR and friends
+func runRepo(dir string, args ...string) ([]byte, error) {
+	c := exec.Command("git", args...)
+	c.Dir = dir
+
+	for _, v := range os.Environ() {
+		name, _, _ := strings.Cut(v, "=")
+		if !slices.Contains(repoEnv, name) {
+			c.Env = append(c.Env, v)
+		}
 	}
 
-	return trimAllSpaces(string(s)) == "true"
+	return c.Output()
 }
 
 // TopLevel tries to get the top level direcory of
-// the current git working directory
+// the git working directory 'dir' is in
 //
-// If 'filepath' is a file, returns a bool indicating
-// whether it is in a git work tree
-// If 'filepath' is a directory, returns a bool indicatind
-// whether it is a git repository
-//
-// The second return value is the path to the top level
-// git repository (if the first return value is true
-func TopLevel(filepath string, isDir bool) (bool, string) {
-	var err error
-	cwd, err := os.Getwd()
-	defer func() {
-		if isDir {
-			os.Chdir(cwd)
-		}
-	}()
+// The first return value indicates whether 'dir' is in
+// a git work tree, the second one is the path to the top
+// level git repository (if the first return value is true)
+// and the third one is the path of 'dir' relative to it
+func TopLevel(dir string) (bool, string, string) {
+	out, err := run(dir, "rev-parse", "--is-inside-work-tree", "--show-toplevel", "--show-prefix")
 
 	if err != nil {
-		panic(err)
+		return false, "", ""
 	}
 
-	inVCS := false
-	topLevel := ""
-
-	if isDir {
-		err = os.Chdir(filepath)
+	// git runs from the top level of GIT_WORK_TREE
+	// when 'dir' is outside of it
+	lines := strings.Split(string(out), "\n")
+	if len(lines) < 3 || lines[0] != "true" {
+		return false, "", ""
 	}
 
-	if err == nil {
-		inVCS = IsInWorkTree()
-
-		if inVCS {
-			var t []byte
-			t, err = exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	return true, trimAllSpaces(lines[1]), strings.TrimSuffix(lines[2], "/")
+}
 
-			topLevel = trimAllSpaces(string(t))
-		}
-	}
+// Returns true if 'dir' is the top level of a repository,
+// without spawning any git process
+func IsRepository(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, ".git"))
 
-	if err != nil {
-		panic(err)
-	}
-
-	return inVCS, topLevel
+	return err == nil
 }
 
-// Gets the git branch name
-// 'toplevel' is the path the top level git repository
-// 'dir' is the path to the directory we want to check
-// Returns an empty string if dir is not a repository
-func GetBranchName(topLevel string, dir string) string {
-	b, err := exec.Command("git", fmt.Sprintf("--git-dir=%s/.git", topLevel), fmt.Sprintf("--work-tree=%s", dir), "rev-parse", "--abbrev-ref", "HEAD").Output()
+// Describes the repository at 'dir', the path to the top level
+// of the repository
+// Returns nil if 'dir' is not a repository
+func GetRepo(dir string) *Repo {
+	repo, err := backend.Repo(dir)
 
 	if err != nil {
-		return ""
+		return nil
 	}
 
-	return strings.Trim(string(b), " \n\r\t\v\f")
+	repo.readState(dir)
+
+	return repo
 }
 
-// Get the git status for a repository
-// 'topLevel' is the path to the top level repository
-// 'dir' is the path to the directory we want to check
-//
-// If 'dir' is not a repository, return "--"
-// If 'dir' has no pending changes, returns "DG"
-// If 'dir' is dirty, return " M"
-func RepoStatus(topLevel string, dir string) string {
-	var status string = "--"
-	s := exec.Command("git", fmt.Sprintf("--git-dir=%s/.git", topLevel), fmt.Sprintf("--work-tree=%s", dir), "diff", "--stat", "--quiet", "--ignore-submodules", "HEAD").ProcessState.ExitCode()
-
-	if s == 1 {
-		// Custom status "Directory Good"
-		status = "DG"
-	} else {
-		status = " M"
+// Returns the abbreviated form of a commit hash
+func shortHash(oid string) string {
+	if len(oid) > 7 {
+		return oid[:7]
 	}
 
-	return status
+	return oid
 }
 
-// Returns true if 'path' is gitignored
-func IsIgnored(path string) bool {
-	c := exec.Command("git", "check-ignore", "--quiet", path)
-	c.Run()
+// Maximum number of repositories read at once
+const repoWorkers = 8
 
-	s := c.ProcessState.ExitCode()
+// Parallel calls 'work' with every index below 'n', reading
+// at most repoWorkers repositories at once, and returns when
+// all the calls have returned
+func Parallel(n int, work func(i int)) {
+	jobs := make(chan int)
 
-	return s == 0
-}
+	var wg sync.WaitGroup
+	for w := 0; w < min(repoWorkers, n); w++ {
+		wg.Add(1)
 
-// Returns true if directroy at 'dirpath' has changes
-func HasDirectoryChanges(dirpath string) bool {
-	c := exec.Command("git", "diff", "--stat", "--exit-code", "--quiet", "--ignore-submodules", dirpath)
-	c.Run()
+		go func() {
+			defer wg.Done()
 
-	s := c.ProcessState.ExitCode()
-
-	return s == 1
-}
+			for i := range jobs {
+				work(i)
+			}
+		}()
+	}
 
-// Returns status of a directory inside a git repo
-// "  " -> no changes
-// "!!" -> ignored
-// " M" -> pending changes
-func DirectoryStatus(dir string) string {
-	var status string = "  "
-
-	if IsIgnored(dir) {
-		status = "!!"
-	} else if HasDirectoryChanges(dir) {
-		status = " M"
+	for i := 0; i < n; i++ {
+		jobs <- i
 	}
+	close(jobs)
 
-	return status
+	wg.Wait()
 }
 
-// Returns status of a file inside a git repo
-func FileStatus(path string) string {
-	var status string = "  "
-	o, err := exec.Command("git", "status", "--porcelain", "--ignored", "--untracked-files=normal", path).Output()
+// LoadRepos describes the repositories among the directories
+// 'dirs' of a listing, several of them at once, keyed by path
+// 'statuses' holds the status of the listed directory, and is
+// nil when the directory is not inside a git work tree
+// The work tree the directory is in is left out
+func LoadRepos(dirs []string, statuses *Statuses) map[string]*Repo {
+	found := []string{}
+	for _, dir := range dirs {
+		if !IsRepository(dir) {
+			continue
+		}
 
-	if err != nil {
-		panic(err)
+		if statuses != nil {
+			if rel, ok := statuses.relative(dir); !ok || rel == "" {
+				continue
+			}
+		}
+
+		found = append(found, dir)
 	}
 
-	lines := strings.Split(string(o), "\n")
+	repos := make(map[string]*Repo)
 
-	if len(lines) > 0 {
+	var mu sync.Mutex
+	Parallel(len(found), func(i int) {
+		dir := found[i]
 
-		out := strings.Trim(lines[0], "\n\r\t\v\f")
+		repo := GetRepo(dir)
+		if repo == nil {
+			return
+		}
 
-		if len(out) >= 2 {
-			status = out[0:2]
+		if statuses != nil && statuses.IsSubmodule(dir) {
+			repo.Kind = RepoSubmodule
+			repo.AtRecordedCommit = statuses.AtRecordedCommit(dir)
 		}
-	}
 
-	return status
+		mu.Lock()
+		repos[dir] = repo
+		mu.Unlock()
+	})
+
+	return repos
 }
 
 // Returns the status of a file/directory/repo
-// If fullpath is a repository, the second return value is
-// the git brach this repository is on
-func Status(fullpath string, file os.FileInfo, insideVCS bool) (string, string) {
-
+// 'statuses' holds the status of the listed directory, and is
+// nil when the directory is not inside a git work tree
+// 'repos' holds the repositories of the listing, see LoadRepos
+// If fullpath is a repository, the second return value
+// describes it (branch, upstream…), otherwise it is nil
+func Status(fullpath string, file os.FileInfo, statuses *Statuses, repos map[string]*Repo) (string, *Repo) {
 	status := "--" // Custom status for "not a repo"
-	branch := ""
-	isDir := file.IsDir()
-
-	isRepo, topLevel := TopLevel(fullpath, isDir)
-
-	if isRepo {
-		// The file is a repository, but we are not in one
-		// Display the branch and status (good/dirty)
-		if !insideVCS {
-			branch = GetBranchName(topLevel, fullpath)
+	repo := repos[fullpath]
 
-			if isDir {
-				status = RepoStatus(topLevel, fullpath)
-			}
+	if statuses != nil {
+		if file.IsDir() {
+			status = statuses.DirectoryStatus(fullpath)
 		} else {
-			if isDir {
-				status = DirectoryStatus(fullpath)
-			} else {
-				status = FileStatus(fullpath)
-			}
+			status = statuses.FileStatus(fullpath)
 		}
+	} else if repo != nil {
+		// The file is a repository, but we are not in one
+		// Display the branch and status (good/dirty)
+		status = repo.Status
 	}
 
-	return status, branch
+	return status, repo
 }
@@ -0,0 +1,405 @@
+package git
+
+// Last commit touching each entry of a directory listing
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commit describes the last commit touching an entry
+type Commit struct {
+	// Abbreviated commit id
+	Hash   string
+	Author string
+	// Committer date
+	Time time.Time
+	// First line of the message
+	Subject string
+}
+
+// History holds the last commit touching each entry
+// directly inside a directory, found in a single walk
+// of the history of the current branch, or of a revision
+type History struct {
+	// Directory the history was collected for
+	dir string
+	// Commits keyed by entry name, "" for 'dir' itself
+	commits map[string]*Commit
+	// Names the walk stops at once they all have a commit
+	wanted  map[string]bool
+	missing int
+}
+
+// LoadHistory finds the last commit touching the directory
+// 'dir' and each of its entries, in the history of the
+// revision 'rev' ("" for HEAD), with the selected backend
+//
+// The walk stops as soon as every entry of 'names' is found:
+// leave out the entries git doesn't track (untracked, ignored),
+// or the whole history gets walked
+func LoadHistory(dir string, rev string, names []string) (*History, error) {
+	if strings.HasPrefix(rev, "-") {
+		return nil, fmt.Errorf("invalid revision %q", rev)
+	}
+
+	return backend.History(dir, rev, names)
+}
+
+func newHistory(dir string, names []string) *History {
+	h := &History{
+		dir:     dir,
+		commits: make(map[string]*Commit),
+		wanted:  map[string]bool{"": true},
+	}
+
+	for _, name := range names {
+		h.wanted[name] = true
+	}
+	h.missing = len(h.wanted)
+
+	return h
+}
+
+// Records 'c' as the last commit touching the entry 'name',
+// unless a more recent one was already found
+func (h *History) found(name string, c *Commit) {
+	if _, ok := h.commits[name]; ok {
+		return
+	}
+
+	h.commits[name] = c
+	if h.wanted[name] {
+		h.missing--
+	}
+}
+
+// Returns true once every wanted entry has a commit
+func (h *History) complete() bool {
+	return h.missing == 0
+}
+
+// Returns the last commit touching a file or directory
+// directly inside the listed directory (or the directory
+// itself), nil if it is not tracked
+func (h *History) LastCommit(fullpath string) *Commit {
+	rel, err := filepath.Rel(h.dir, fullpath)
+	if err != nil {
+		return nil
+	}
+
+	if rel == "." {
+		rel = ""
+	}
+
+	return h.commits[filepath.ToSlash(rel)]
+}
+
+// Walks `git log --name-only` from 'dir', stopping
+// the process once every wanted entry is found
+func execHistory(dir string, rev string, names []string) (*History, error) {
+	// Signatures would be printed with the commits
+	// when log.showSignature is set
+	args := []string{"-c", "log.showSignature=false", "log", "--no-show-signature", "-z", "--relative", "--name-only", "--no-renames", "--format=%x01%H%x00%an%x00%ct%x00%s"}
+	if rev != "" {
+		args = append(args, rev)
+	}
+
+	c := exec.Command("git", append(args, "--", ".")...)
+	c.Dir = dir
+
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	h := newHistory(dir, names)
+	out := bufio.NewReader(stdout)
+
+	// Each commit is "\x01<hash>\0<author>\0<time>\0<subject>\0", followed
+	// by "\n" and the NUL terminated paths it touches, if any
+	var current *Commit
+	field := 0
+
+	for !h.complete() {
+		token, err := out.ReadString(0)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.Process.Kill()
+			c.Wait()
+			return nil, err
+		}
+
+		token = strings.TrimSuffix(token, "\x00")
+
+		if hash, ok := strings.CutPrefix(token, "\x01"); ok {
+			current = &Commit{Hash: shortHash(hash)}
+			field = 1
+			continue
+		}
+
+		switch field {
+		case 1:
+			current.Author = token
+			field++
+		case 2:
+			seconds, _ := strconv.ParseInt(token, 10, 64)
+			current.Time = time.Unix(seconds, 0)
+			field++
+		case 3:
+			current.Subject = token
+			field++
+			h.found("", current)
+		default:
+			name, _, _ := strings.Cut(strings.TrimPrefix(token, "\n"), "/")
+			if current != nil && name != "" {
+				h.found(name, current)
+			}
+		}
+	}
+
+	if h.complete() {
+		// No need for the rest of the history
+		c.Process.Kill()
+		c.Wait()
+
+		return h, nil
+	}
+
+	if err := c.Wait(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// nativeHistory finds the same commits as execHistory, walking
+// the history from 'rev' or HEAD, most recent commits first
+//
+// Like `git log -- <dir>`, only the parent a merge doesn't
+// change 'dir' from is followed, if any, and like
+// `git log --name-only`, merges are only credited for 'dir'
+// itself: git lists no files for them
+func nativeHistory(dir string, rev string, names []string) (*History, error) {
+	r, prefix, err := findRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.close()
+
+	h := newHistory(dir, names)
+
+	_, head, _ := r.head()
+	if rev != "" {
+		if head, err = r.resolveRevision(rev); err != nil {
+			return nil, err
+		}
+	}
+
+	if head == "" {
+		return h, nil
+	}
+
+	store, err := r.objects()
+	if err != nil {
+		return nil, err
+	}
+
+	// Annotated tags
+	if head, err = store.peel(head); err != nil {
+		return nil, err
+	}
+
+	queue := &commitQueue{}
+	queued := make(map[string]bool)
+
+	push := func(oid string) error {
+		if queued[oid] {
+			return nil
+		}
+		queued[oid] = true
+
+		c, err := store.readCommit(oid)
+		if err != nil {
+			return err
+		}
+
+		heap.Push(queue, queuedCommit{oid, c.time})
+
+		return nil
+	}
+
+	if err := push(head); err != nil {
+		return nil, err
+	}
+
+	for queue.Len() > 0 && !h.complete() {
+		oid := heap.Pop(queue).(queuedCommit).oid
+
+		c, err := store.readCommit(oid)
+		if err != nil {
+			return nil, err
+		}
+
+		tree, err := store.subtree(c.tree, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		// A root commit changes 'dir' if it has it
+		parents := c.parents
+		treesame := len(parents) == 0 && tree == ""
+		parentTrees := []string{}
+
+		for _, parent := range c.parents {
+			pc, err := store.readCommit(parent)
+			if err != nil {
+				return nil, err
+			}
+
+			parentTree, err := store.subtree(pc.tree, prefix)
+			if err != nil {
+				return nil, err
+			}
+
+			if parentTree == tree {
+				treesame = true
+				parents = []string{parent}
+				break
+			}
+
+			parentTrees = append(parentTrees, parentTree)
+		}
+
+		if !treesame {
+			commit := &Commit{
+				Hash:    shortHash(oid),
+				Author:  c.author,
+				Time:    time.Unix(c.time, 0),
+				Subject: c.subject,
+			}
+
+			h.found("", commit)
+
+			changed := []string{}
+			if len(c.parents) < 2 {
+				if changed, err = store.changedEntries(tree, parentTrees); err != nil {
+					return nil, err
+				}
+			}
+
+			for _, name := range changed {
+				h.found(name, commit)
+			}
+		}
+
+		for _, parent := range parents {
+			if err := push(parent); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// Returns the id of the tree at 'prefix' in the tree 'oid',
+// empty if there is no such directory
+func (s *objectStore) subtree(oid string, prefix string) (string, error) {
+	if prefix == "" {
+		return oid, nil
+	}
+
+	for _, name := range strings.Split(prefix, "/") {
+		entries, err := s.readTree(oid)
+		if err != nil {
+			return "", err
+		}
+
+		oid = ""
+		for _, entry := range entries {
+			if entry.name == name && entry.mode == 040000 {
+				oid = entry.oid
+				break
+			}
+		}
+
+		if oid == "" {
+			return "", nil
+		}
+	}
+
+	return oid, nil
+}
+
+// Returns the names of the entries of the tree 'oid' that
+// differ from every tree of 'parents' (all of them
+// when there are no parents)
+// Empty ids stand for missing trees
+func (s *objectStore) changedEntries(oid string, parents []string) ([]string, error) {
+	entries, err := s.treeEntries(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	parentEntries := make([]map[string]string, 0, len(parents))
+	for _, parent := range parents {
+		pe, err := s.treeEntries(parent)
+		if err != nil {
+			return nil, err
+		}
+
+		parentEntries = append(parentEntries, pe)
+	}
+
+	changed := []string{}
+
+	for name, entryOid := range entries {
+		same := false
+		for _, pe := range parentEntries {
+			if pe[name] == entryOid {
+				same = true
+				break
+			}
+		}
+
+		if !same {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed, nil
+}
+
+// Returns the object ids of the entries of a tree, by name
+func (s *objectStore) treeEntries(oid string) (map[string]string, error) {
+	result := make(map[string]string)
+	if oid == "" {
+		return result, nil
+	}
+
+	entries, err := s.readTree(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		result[entry.name] = entry.oid
+	}
+
+	return result, nil
+}
@@ -0,0 +1,128 @@
+package git
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	dir := newFixture(t)
+
+	for i, files := range []map[string]string{
+		{"a.txt": "a", "dir/b.txt": "b"},
+		{"a.txt": "a2"},
+		{"dir/c.txt": "c", "other/d.txt": "d"},
+		{"dir/b.txt": "b2"},
+	} {
+		writeFiles(t, dir, files)
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "-q", "-m", "commit "+string(rune('1'+i)))
+	}
+
+	names := []string{"a.txt", "dir", "other"}
+
+	// Signatures are shown with the commits
+	// once log.showSignature is set
+	signed := func(t *testing.T) {
+		writeFiles(t, dir, map[string]string{"signed.txt": "signed"})
+		runGit(t, dir, "add", ".")
+		commitSigned(t, dir, "signed")
+		runGit(t, dir, "config", "log.showSignature", "true")
+		names = append(names, "signed.txt")
+	}
+
+	for _, setup := range []struct {
+		name  string
+		setup func(t *testing.T)
+	}{
+		{"unsigned", func(t *testing.T) {}},
+		{"signed", signed},
+	} {
+		t.Run(setup.name, func(t *testing.T) {
+			setup.setup(t)
+
+			for _, sub := range []string{"", "dir"} {
+				path := filepath.Join(dir, sub)
+
+				want, err := execHistory(path, "", names)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := nativeHistory(path, "", names)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(want.commits) == 0 {
+					t.Fatalf("no commits found in %s", path)
+				}
+				for _, c := range want.commits {
+					if c.Hash == "" || c.Author != "Ada" || c.Subject == "" {
+						t.Errorf("git log parsed as %+v", c)
+					}
+				}
+
+				if !reflect.DeepEqual(got.commits, want.commits) {
+					for name, c := range want.commits {
+						if got.commits[name] == nil || *got.commits[name] != *c {
+							t.Errorf("last commit of %q in %s = %+v, want %+v", name, path, got.commits[name], c)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryMerges(t *testing.T) {
+	dir := newFixture(t)
+
+	commit := func(message string, files map[string]string) {
+		writeFiles(t, dir, files)
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "-q", "-m", message)
+	}
+
+	commit("base", map[string]string{"a.txt": "a", "dir/b.txt": "b", "c.txt": "c"})
+
+	runGit(t, dir, "checkout", "-q", "-b", "side")
+	commit("side", map[string]string{"a.txt": "side", "dir/b.txt": "side"})
+
+	runGit(t, dir, "checkout", "-q", "main")
+	commit("main", map[string]string{"c.txt": "main"})
+
+	// Changes of its own too, that git log lists no file for
+	runGit(t, dir, "merge", "-q", "--no-ff", "--no-commit", "side")
+	writeFiles(t, dir, map[string]string{"c.txt": "merge"})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "merge")
+
+	names := []string{"a.txt", "c.txt", "dir"}
+
+	for _, sub := range []string{"", "dir"} {
+		path := filepath.Join(dir, sub)
+
+		want, err := execHistory(path, "", names)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := nativeHistory(path, "", names)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 'dir' only changed on the side branch
+		if c := want.commits[""]; sub == "" && (c == nil || c.Subject != "merge") {
+			t.Errorf("last commit of %s = %+v, want the merge", path, c)
+		}
+
+		if !reflect.DeepEqual(got.commits, want.commits) {
+			for name, c := range want.commits {
+				if got.commits[name] == nil || *got.commits[name] != *c {
+					t.Errorf("last commit of %q in %s = %+v, want %+v", name, path, got.commits[name], c)
+				}
+			}
+		}
+	}
+}
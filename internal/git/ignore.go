@@ -0,0 +1,212 @@
+package git
+
+// Matching paths against .gitignore files
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// ignoreRule is one pattern of an ignore file
+type ignoreRule struct {
+	// Directory containing the ignore file, relative
+	// to the top level ("" for the top level itself,
+	// info/exclude and the global excludes file)
+	base    string
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	// Patterns without a slash match the name of
+	// an entry at any depth
+	basename bool
+}
+
+// ignoreRules is a list of rules, the last one matching
+// a path decides whether it is ignored
+type ignoreRules []ignoreRule
+
+// Reads the rules of an ignore file located in 'base'
+func (rules ignoreRules) load(filename string, base string) ignoreRules {
+	f, err := os.Open(filename)
+	if err != nil {
+		return rules
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// Loads the rules that apply to the whole repository:
+// the global excludes file and .git/info/exclude
+func (r *repository) baseIgnoreRules() ignoreRules {
+	rules := ignoreRules{}
+
+	excludesFile := r.config.get("core.excludesfile", "")
+	if excludesFile == "" {
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if xdg == "" {
+			if home, err := homedir.Dir(); err == nil {
+				xdg = filepath.Join(home, ".config")
+			}
+		}
+
+		if xdg != "" {
+			excludesFile = filepath.Join(xdg, "git", "ignore")
+		}
+	}
+
+	if excludesFile != "" {
+		rules = rules.load(expandHome(excludesFile), "")
+	}
+
+	return rules.load(filepath.Join(r.commonDir, "info", "exclude"), "")
+}
+
+// Adds the rules of the .gitignore file of the directory 'dir'
+// (relative to the top level)
+func (r *repository) dirIgnoreRules(rules ignoreRules, dir string) ignoreRules {
+	// Don't let appends to a child's rules overwrite a sibling's
+	rules = rules[:len(rules):len(rules)]
+
+	return rules.load(filepath.Join(r.workTree, filepath.FromSlash(dir), ".gitignore"), dir)
+}
+
+// Returns true if the path 'p' (relative to the top level) is ignored
+func (rules ignoreRules) ignored(p string, isDir bool) bool {
+	for i := len(rules) - 1; i >= 0; i-- {
+		rule := rules[i]
+
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		if rule.base != "" && !strings.HasPrefix(p, rule.base+"/") {
+			continue
+		}
+
+		target := p
+		if rule.basename {
+			target = path.Base(p)
+		} else if rule.base != "" {
+			target = p[len(rule.base)+1:]
+		}
+
+		if rule.pattern.MatchString(target) {
+			return !rule.negate
+		}
+	}
+
+	return false
+}
+
+// Parses a line of an ignore file
+func parseIgnoreRule(line string, base string) (ignoreRule, bool) {
+	rule := ignoreRule{base: base}
+
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+
+	if line == "" || line[0] == '#' {
+		return rule, false
+	}
+
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if line[0] == '\\' && len(line) > 1 && (line[1] == '!' || line[1] == '#') {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	if line == "" {
+		return rule, false
+	}
+
+	rule.basename = !strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	pattern, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return rule, false
+	}
+
+	rule.pattern = pattern
+
+	return rule, true
+}
+
+// Converts a gitignore glob into a regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		ch := glob[i]
+
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			// Leading or inner "**/": any number of directories
+			if i == 0 || glob[i-1] == '/' {
+				b.WriteString("(?:.*/)?")
+				i += 2
+			} else {
+				b.WriteString("[^/]*")
+				i++
+			}
+
+		case strings.HasPrefix(glob[i:], "**") && i+2 == len(glob) && (i == 0 || glob[i-1] == '/'):
+			// Trailing "/**": everything inside
+			b.WriteString(".*")
+			i++
+
+		case ch == '*':
+			b.WriteString("[^/]*")
+
+		case ch == '?':
+			b.WriteString("[^/]")
+
+		case ch == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			b.WriteString("[" + strings.ReplaceAll(class, "\\", "\\\\") + "]")
+			i += end + 1
+
+		case ch == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package git
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	dir := newFixture(t)
+
+	writeFiles(t, dir, map[string]string{
+		".gitignore": strings.Join([]string{
+			"# comment",
+			"*.log",
+			"!keep.log",
+			"/root.txt",
+			"build/",
+			"docs/**/*.md",
+			"**/cache",
+			"a/**/z",
+			"everything/**",
+			"tmp*/",
+			"\\#hash",
+			"\\!bang",
+			"trailing   ",
+			"escaped\\ ",
+			"[ab]ch?r.txt",
+			"[!x]neg.txt",
+		}, "\n"),
+		"sub/.gitignore": strings.Join([]string{
+			"*.tmp",
+			"!/important.tmp",
+			"/local",
+			"deep/only",
+		}, "\n"),
+		".git/info/exclude": "secret\n",
+	})
+
+	// Paths to check, directories end with a slash
+	paths := []string{
+		"app.log", "keep.log", "sub/keep.log", "sub/app.log",
+		"root.txt", "sub/root.txt",
+		"build/", "sub/build/", "build.txt", "out/build",
+		"docs/a.md", "docs/x/y/b.md", "docs/readme.txt", "other/docs/a.md",
+		"cache/", "sub/deep/cache", "cache.txt",
+		"a/z", "a/b/c/z", "b/a/z",
+		"everything/x", "everything/",
+		"tmpfiles/", "tmp.txt",
+		"#hash", "!bang", "hash",
+		"trailing", "escaped ", "escaped",
+		"achr.txt", "bchar.txt", "cchr.txt", "yneg.txt", "xneg.txt",
+		"sub/x.tmp", "sub/important.tmp", "sub/deep/important.tmp",
+		"sub/local", "sub/deep/local", "sub/deep/only", "sub/other/deep/only",
+		"secret", "sub/secret/",
+	}
+
+	for _, p := range paths {
+		fullpath := filepath.Join(dir, filepath.FromSlash(p))
+		if strings.HasSuffix(p, "/") {
+			writeFiles(t, dir, map[string]string{p + "file": ""})
+		} else if err := os.MkdirAll(filepath.Dir(fullpath), 0o755); err != nil {
+			t.Fatal(err)
+		} else if err := os.WriteFile(fullpath, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// "<source>:<line>:<pattern>\t<path>", with empty fields
+	// when no pattern matches, negated patterns starting with '!'
+	// git tells directories from files on disk
+	input := strings.ReplaceAll(strings.Join(paths, "\n")+"\n", "/\n", "\n")
+	out := runGitInput(t, dir, input, "check-ignore", "--stdin", "--verbose", "--non-matching", "--no-index")
+	want := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		match, p, _ := strings.Cut(line, "\t")
+		pattern := match[strings.LastIndexByte(match[:len(match)-1], ':')+1:]
+
+		want[p] = pattern != ":" && pattern != "" && !strings.HasPrefix(pattern, "!")
+	}
+
+	r := openFixture(t, dir)
+
+	for _, p := range paths {
+		isDir := strings.HasSuffix(p, "/")
+		name := strings.TrimSuffix(p, "/")
+
+		// Rules of the ignore files of the directories
+		// leading to the path
+		rules := r.dirIgnoreRules(r.baseIgnoreRules(), "")
+		if parent := path.Dir(name); parent != "." {
+			d := ""
+			for _, part := range strings.Split(parent, "/") {
+				d = path.Join(d, part)
+				rules = r.dirIgnoreRules(rules, d)
+			}
+		}
+
+		if got := rules.ignored(name, isDir); got != want[name] {
+			t.Errorf("ignored(%q, %v) = %v, want %v", name, isDir, got, want[name])
+		}
+	}
+}
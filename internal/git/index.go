@@ -0,0 +1,195 @@
+package git
+
+// Reading the .git/index file
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var errCorruptIndex = errors.New("corrupt index file")
+
+// indexEntry is one entry of the index, with the stat
+// data git recorded when the file was last staged
+type indexEntry struct {
+	path      string
+	oid       string
+	mode      uint32
+	stage     int
+	mtimeSec  uint32
+	mtimeNsec uint32
+	ino       uint32
+	size      uint32
+	// Set by `git update-index --skip-worktree` and sparse checkouts
+	skipWorktree bool
+	// Set by `git add --intent-to-add`
+	intentToAdd bool
+}
+
+// index is the parsed content of .git/index
+type index struct {
+	entries []indexEntry
+	// Modification time of the index file itself,
+	// to detect racily clean entries
+	mtime int64
+}
+
+// Reads the index of a repository
+// A missing index (a fresh repository) is empty
+// Split and sparse indexes are not supported
+func (r *repository) readIndex() (*index, error) {
+	filename := filepath.Join(r.gitDir, "index")
+
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return &index{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := parseIndex(b)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.mtime = info.ModTime().UnixNano()
+
+	return idx, nil
+}
+
+func parseIndex(b []byte) (*index, error) {
+	if len(b) < 12+sha1.Size || !bytes.Equal(b[:4], []byte("DIRC")) {
+		return nil, errCorruptIndex
+	}
+
+	version := binary.BigEndian.Uint32(b[4:8])
+	if version < 2 || version > 4 {
+		return nil, errUnsupported
+	}
+
+	count := int(binary.BigEndian.Uint32(b[8:12]))
+	end := len(b) - sha1.Size
+	pos := 12
+	previous := ""
+
+	idx := &index{entries: make([]indexEntry, 0, count)}
+
+	for i := 0; i < count; i++ {
+		if pos+62 > end {
+			return nil, errCorruptIndex
+		}
+
+		e := b[pos:]
+		flags := binary.BigEndian.Uint16(e[60:62])
+
+		entry := indexEntry{
+			mtimeSec:  binary.BigEndian.Uint32(e[8:12]),
+			mtimeNsec: binary.BigEndian.Uint32(e[12:16]),
+			ino:       binary.BigEndian.Uint32(e[20:24]),
+			mode:      binary.BigEndian.Uint32(e[24:28]),
+			size:      binary.BigEndian.Uint32(e[36:40]),
+			oid:       hex.EncodeToString(e[40:60]),
+			stage:     int(flags>>12) & 3,
+		}
+
+		headerSize := 62
+		if flags&0x4000 != 0 {
+			if version < 3 || pos+64 > end {
+				return nil, errCorruptIndex
+			}
+
+			extended := binary.BigEndian.Uint16(e[62:64])
+			entry.skipWorktree = extended&0x4000 != 0
+			entry.intentToAdd = extended&0x2000 != 0
+			headerSize = 64
+		}
+
+		pos += headerSize
+
+		if version == 4 {
+			// The path is stored as the number of bytes to
+			// remove from the previous path, and a suffix
+			strip, n := indexVarint(b[pos:end])
+			if n == 0 || strip > len(previous) {
+				return nil, errCorruptIndex
+			}
+			pos += n
+
+			suffix := bytes.IndexByte(b[pos:end], 0)
+			if suffix < 0 {
+				return nil, errCorruptIndex
+			}
+
+			entry.path = previous[:len(previous)-strip] + string(b[pos:pos+suffix])
+			pos += suffix + 1
+		} else {
+			name := bytes.IndexByte(b[pos:end], 0)
+			if name < 0 {
+				return nil, errCorruptIndex
+			}
+
+			entry.path = string(b[pos : pos+name])
+			// Entries are padded with 1 to 8 NULs to a multiple of 8 bytes
+			pos += (headerSize+name+8)&^7 - headerSize
+		}
+
+		// Sparse directory entries
+		if entry.mode&0170000 == 040000 {
+			return nil, errUnsupported
+		}
+
+		previous = entry.path
+		idx.entries = append(idx.entries, entry)
+	}
+
+	// Extensions
+	for pos+8 <= end {
+		signature := string(b[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(b[pos+4 : pos+8]))
+
+		switch signature {
+		case "link", "sdir":
+			// Split index, sparse index
+			return nil, errUnsupported
+		}
+
+		pos += 8 + size
+	}
+
+	return idx, nil
+}
+
+// Reads the variable length integers of index version 4
+// Returns the value and the number of bytes read
+func indexVarint(b []byte) (int, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+
+	c := b[0]
+	value := int(c & 0x7f)
+	n := 1
+
+	for c&0x80 != 0 {
+		if n >= len(b) {
+			return 0, 0
+		}
+
+		c = b[n]
+		n++
+		value = ((value + 1) << 7) | int(c&0x7f)
+	}
+
+	return value, n
+}
@@ -0,0 +1,177 @@
+package git
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Formats the entries of an index like `git ls-files -s -v`
+func lsFiles(idx *index) string {
+	var b strings.Builder
+
+	for _, e := range idx.entries {
+		tag := "H"
+		switch {
+		case e.stage != 0:
+			tag = "M"
+		case e.skipWorktree:
+			tag = "S"
+		}
+
+		fmt.Fprintf(&b, "%s %06o %s %d\t%s\n", tag, e.mode, e.oid, e.stage, e.path)
+	}
+
+	return b.String()
+}
+
+func TestParseIndex(t *testing.T) {
+	tests := []struct {
+		version uint32
+		// Set skip-worktree and intent-to-add, which
+		// need the extended flags of version 3
+		extended bool
+	}{
+		{2, false},
+		{3, true},
+		{4, false},
+		{4, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("v%d extended=%v", tt.version, tt.extended), func(t *testing.T) {
+			dir := newFixture(t)
+
+			// Long common prefixes for the path compression of version 4
+			writeFiles(t, dir, map[string]string{
+				"README":                         "readme\n",
+				"src/internal/deep/file.go":      "package deep\n",
+				"src/internal/deep/file_test.go": "package deep\n",
+				"src/internal/other.go":          "package internal\n",
+				"src/main.go":                    "package main\n",
+				"zz":                             "last\n",
+			})
+			runGit(t, dir, "add", ".")
+			runGit(t, dir, "commit", "-q", "-m", "initial")
+
+			// An unmerged path, in stages 1 to 3
+			blob := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD:README"))
+			runGitInput(t, dir, fmt.Sprintf(
+				"0 %[1]s\tconflict\n100644 %[1]s 1\tconflict\n100644 %[1]s 2\tconflict\n100755 %[1]s 3\tconflict\n", blob),
+				"update-index", "--index-info")
+
+			if tt.extended {
+				runGit(t, dir, "update-index", "--skip-worktree", "src/main.go")
+				writeFiles(t, dir, map[string]string{"src/new.go": "package main\n"})
+				runGit(t, dir, "add", "--intent-to-add", "src/new.go")
+			}
+
+			runGit(t, dir, "update-index", "--index-version", fmt.Sprint(tt.version))
+
+			b, err := os.ReadFile(filepath.Join(dir, ".git", "index"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version := binary.BigEndian.Uint32(b[4:8]); version != tt.version {
+				t.Fatalf("git wrote version %d, want %d", version, tt.version)
+			}
+
+			idx, err := parseIndex(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := lsFiles(idx), runGit(t, dir, "ls-files", "-s", "-v"); got != want {
+				t.Errorf("entries:\n%s\nwant (git ls-files -s -v):\n%s", got, want)
+			}
+
+			for _, e := range idx.entries {
+				if want := tt.extended && e.path == "src/new.go"; e.intentToAdd != want {
+					t.Errorf("%s: intentToAdd = %v, want %v", e.path, e.intentToAdd, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseIndexErrors(t *testing.T) {
+	dir := newFixture(t)
+	writeFiles(t, dir, map[string]string{"a": "a\n"})
+	runGit(t, dir, "add", "a")
+
+	valid, err := os.ReadFile(filepath.Join(dir, ".git", "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Returns a copy of the index with 'edit' applied
+	modified := func(edit func(b []byte) []byte) []byte {
+		return edit(append([]byte{}, valid...))
+	}
+
+	tests := []struct {
+		name  string
+		index []byte
+		err   error
+	}{
+		{"truncated header", valid[:10], errCorruptIndex},
+		{"bad signature", modified(func(b []byte) []byte {
+			copy(b, "DIRX")
+			return b
+		}), errCorruptIndex},
+		{"version 5", modified(func(b []byte) []byte {
+			binary.BigEndian.PutUint32(b[4:8], 5)
+			return b
+		}), errUnsupported},
+		{"more entries than the file holds", modified(func(b []byte) []byte {
+			binary.BigEndian.PutUint32(b[8:12], 1000)
+			return b
+		}), errCorruptIndex},
+		{"sparse index", modified(func(b []byte) []byte {
+			end := len(b) - 20
+			extension := append([]byte("sdir"), 0, 0, 0, 0)
+			return append(b[:end:end], append(extension, b[end:]...)...)
+		}), errUnsupported},
+		{"split index", modified(func(b []byte) []byte {
+			end := len(b) - 20
+			extension := append([]byte("link"), 0, 0, 0, 0)
+			return append(b[:end:end], append(extension, b[end:]...)...)
+		}), errUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseIndex(tt.index); !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestIndexVarint(t *testing.T) {
+	tests := []struct {
+		b     []byte
+		value int
+		n     int
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7f}, 127, 1},
+		// Each continuation byte adds one before shifting
+		{[]byte{0x80, 0x00}, 128, 2},
+		{[]byte{0x80, 0x7f}, 255, 2},
+		{[]byte{0x81, 0x00}, 256, 2},
+		{[]byte{0xff, 0x7f}, 16511, 2},
+		{[]byte{0x80}, 0, 0},
+		{[]byte{}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if value, n := indexVarint(tt.b); value != tt.value || n != tt.n {
+			t.Errorf("indexVarint(%x) = %d, %d, want %d, %d", tt.b, value, n, tt.value, tt.n)
+		}
+	}
+}
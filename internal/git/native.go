@@ -0,0 +1,601 @@
+package git
+
+// Computing git status without the git binary
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// XY codes of unmerged paths, indexed by the stages present
+// in the index (bit 0 for the common ancestor, bit 1 for ours,
+// bit 2 for theirs)
+var conflictCodes = [8]string{"", "DD", "AU", "UD", "UA", "DU", "AA", "UU"}
+
+// nativeStatuses computes what
+// `git status --porcelain --ignored --untracked-files=normal -- .`
+// reports when run from 'dir', without --ignored
+// if 'ignored' is false
+func nativeStatuses(dir string, ignored bool) (*Statuses, error) {
+	repo, prefix, err := findRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	defer repo.close()
+
+	p, err := repo.status(prefix, statusUntracked)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ignored {
+		for path, status := range p.entries {
+			if status == "!!" {
+				delete(p.entries, path)
+			}
+		}
+	}
+
+	return newStatuses(dir, prefix, p), nil
+}
+
+// nativeRepo describes the repository at 'dir', like
+// `git status --porcelain=v2 --branch --untracked-files=no`
+func nativeRepo(dir string) (*Repo, error) {
+	r, err := repositoryAt(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.close()
+
+	repo := &Repo{Status: "DG"}
+
+	branch, oid, detached := r.head()
+	repo.Branch = branch
+	repo.Detached = detached
+
+	if !repo.Detached {
+		if err := r.tracking(repo, oid); err != nil {
+			return nil, err
+		}
+	}
+
+	// Like --ignore-submodules for the exec backend
+	p, err := r.status("", statusIgnoreSubmodules)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range p.entries {
+		if status != "!!" && status != "??" {
+			repo.Status = " M"
+			break
+		}
+	}
+
+	return repo, nil
+}
+
+// Flags of status
+const (
+	// Look for untracked and ignored files
+	statusUntracked = 1 << iota
+	// Leave submodules out, whatever their changes
+	statusIgnoreSubmodules
+)
+
+// Returns the XY code of every path below 'prefix' (relative to
+// the top level) that is not clean, as set by 'flags'
+func (r *repository) status(prefix string, flags int) (*porcelain, error) {
+	idx, err := r.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := r.objects()
+	if err != nil {
+		return nil, err
+	}
+
+	head := make(map[string]treeEntry)
+	if _, oid, _ := r.head(); oid != "" {
+		c, err := store.readCommit(oid)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := store.flattenTree(c.tree, "", prefix, head); err != nil {
+			return nil, err
+		}
+	}
+
+	p := newPorcelain()
+	entries := p.entries
+	tracked := make(map[string]bool)
+	trackedDirs := map[string]bool{"": true}
+	conflicts := make(map[string]int)
+	filters := r.mayFilter(idx)
+
+	for _, e := range idx.entries {
+		tracked[e.path] = true
+		for d := parentDir(e.path); !trackedDirs[d]; d = parentDir(d) {
+			trackedDirs[d] = true
+		}
+
+		if !isUnder(e.path, prefix) {
+			continue
+		}
+
+		if e.stage > 0 {
+			conflicts[e.path] |= 1 << (e.stage - 1)
+			continue
+		}
+
+		if e.mode == 0160000 && flags&statusIgnoreSubmodules != 0 {
+			continue
+		}
+
+		x := indexChange(e, head)
+
+		var y byte
+		if e.mode == 0160000 {
+			y, err = r.submoduleChange(e, p.submodules)
+		} else {
+			y, err = r.workTreeChange(e, idx.mtime, filters)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if x != ' ' || y != ' ' {
+			entries[e.path] = string([]byte{x, y})
+		}
+	}
+
+	for p, stages := range conflicts {
+		entries[p] = conflictCodes[stages]
+	}
+
+	// Deleted from the index
+	for p, h := range head {
+		if h.mode == 0160000 && flags&statusIgnoreSubmodules != 0 {
+			continue
+		}
+
+		if !tracked[p] {
+			entries[p] = "D "
+		}
+	}
+
+	if flags&statusUntracked != 0 {
+		w := untrackedWalker{r, tracked, trackedDirs, entries}
+		if err := w.walk(prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Returns the index column of the XY code of an entry,
+// comparing it to the HEAD commit
+func indexChange(e indexEntry, head map[string]treeEntry) byte {
+	if e.intentToAdd {
+		return ' '
+	}
+
+	h, ok := head[e.path]
+
+	switch {
+	case !ok:
+		return 'A'
+	case h.mode&0170000 != e.mode&0170000:
+		return 'T'
+	case h.oid != e.oid || h.mode != e.mode:
+		return 'M'
+	}
+
+	return ' '
+}
+
+// Returns the work tree column of the XY code of an entry,
+// comparing the file on disk with the index
+// Files are only hashed when their stat data doesn't match
+// the one recorded in the index
+func (r *repository) workTreeChange(e indexEntry, indexMtime int64, filters bool) (byte, error) {
+	if e.skipWorktree {
+		return ' ', nil
+	}
+
+	if e.intentToAdd {
+		return 'A', nil
+	}
+
+	fullpath := filepath.Join(r.workTree, filepath.FromSlash(e.path))
+
+	info, err := os.Lstat(fullpath)
+	if err != nil {
+		return 'D', nil
+	}
+
+	mode := info.Mode()
+
+	switch {
+	case mode&os.ModeSymlink != 0:
+		if e.mode&0170000 != 0120000 {
+			return 'T', nil
+		}
+	case mode.IsRegular():
+		if e.mode&0170000 != 0100000 {
+			return 'T', nil
+		}
+		if r.config.bool("core.filemode", true) && (mode&0100 != 0) != (e.mode&0100 != 0) {
+			return 'M', nil
+		}
+	default:
+		return 'D', nil
+	}
+
+	mtime := info.ModTime()
+	statClean := uint32(info.Size()) == e.size &&
+		uint32(mtime.Unix()) == e.mtimeSec &&
+		uint32(mtime.Nanosecond()) == e.mtimeNsec &&
+		// Racily clean entries, modified in the same instant
+		// the index was written, need their content checked
+		mtime.UnixNano() < indexMtime
+
+	if statClean {
+		return ' ', nil
+	}
+
+	if uint32(info.Size()) != e.size && !filters {
+		return 'M', nil
+	}
+
+	var content []byte
+	if mode&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullpath)
+		if err != nil {
+			return 'D', nil
+		}
+		content = []byte(target)
+	} else if content, err = os.ReadFile(fullpath); err != nil {
+		return 'D', nil
+	}
+
+	if hashBlob(content) == e.oid {
+		return ' ', nil
+	}
+
+	if filters {
+		// The content may only differ because of line endings
+		// or clean filters, which only git knows how to apply
+		return ' ', errUnsupported
+	}
+
+	return 'M', nil
+}
+
+// Returns the work tree column of the XY code of a submodule:
+// 'M' if it is not at the commit recorded in the index,
+// or has changes of its own
+// The state of changed submodules is recorded in 'submodules'
+func (r *repository) submoduleChange(e indexEntry, submodules map[string]string) (byte, error) {
+	fullpath := filepath.Join(r.workTree, filepath.FromSlash(e.path))
+
+	info, err := os.Lstat(fullpath)
+	if err != nil {
+		return 'D', nil
+	}
+	if !info.IsDir() {
+		return 'T', nil
+	}
+
+	// Submodules that are not checked out are clean
+	if _, err := os.Lstat(filepath.Join(fullpath, ".git")); err != nil {
+		return ' ', nil
+	}
+
+	sub, err := repositoryAt(fullpath)
+	if err != nil {
+		return ' ', err
+	}
+
+	defer sub.close()
+
+	// "S<c><m><u>": commit changed, tracked changes, untracked files
+	state := []byte("S...")
+
+	if _, oid, _ := sub.head(); oid != e.oid {
+		state[1] = 'C'
+	}
+
+	p, err := sub.status("", statusUntracked)
+	if err != nil {
+		return ' ', err
+	}
+
+	for _, status := range p.entries {
+		if status == "??" {
+			state[3] = 'U'
+		} else if status != "!!" {
+			state[2] = 'M'
+		}
+	}
+
+	if string(state) == "S..." {
+		return ' ', nil
+	}
+
+	submodules[e.path] = string(state)
+
+	return 'M', nil
+}
+
+// Returns true if the content of files may be transformed
+// when they are staged (line endings conversion, filters),
+// in which case hashing files on disk is not reliable
+func (r *repository) mayFilter(idx *index) bool {
+	if autocrlf := r.config.get("core.autocrlf", "false"); autocrlf != "false" {
+		return true
+	}
+
+	attributes := []string{
+		filepath.Join(r.commonDir, "info", "attributes"),
+	}
+
+	global := r.config.get("core.attributesfile", "")
+	if global == "" {
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if xdg == "" {
+			if home, err := homedir.Dir(); err == nil {
+				xdg = filepath.Join(home, ".config")
+			}
+		}
+
+		if xdg != "" {
+			global = filepath.Join(xdg, "git", "attributes")
+		}
+	}
+
+	if global != "" {
+		attributes = append(attributes, expandHome(global))
+	}
+
+	for _, e := range idx.entries {
+		if path.Base(e.path) == ".gitattributes" {
+			attributes = append(attributes, filepath.Join(r.workTree, filepath.FromSlash(e.path)))
+		}
+	}
+
+	for _, filename := range attributes {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+
+		if attributesFilter(string(b)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true if a line of the attributes file 'content'
+// sets one of the attributes that transform the content
+// of files when they are staged
+// Macros ("[attr]name ...") setting them count as well
+func attributesFilter(content string) bool {
+	macros := map[string]bool{}
+
+	for _, line := range strings.Split(content, "\n") {
+		line = trimAllSpaces(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		macro, isMacro := strings.CutPrefix(line, "[attr]")
+
+		// Quoted patterns may contain spaces
+		var rest string
+		if line[0] == '"' {
+			end := 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			rest = line[min(end+1, len(line)):]
+		} else {
+			_, rest, _ = strings.Cut(strings.ReplaceAll(line, "\t", " "), " ")
+		}
+
+		filters := false
+		for _, attr := range strings.Fields(rest) {
+			if filterAttribute(attr) || macros[attr] {
+				filters = true
+				break
+			}
+		}
+
+		if !filters {
+			continue
+		}
+
+		if !isMacro {
+			return true
+		}
+
+		name, _, _ := strings.Cut(strings.ReplaceAll(macro, "\t", " "), " ")
+		macros[name] = true
+	}
+
+	return false
+}
+
+// Returns true if 'attr', as written in an attributes file,
+// sets an attribute that transforms the content of files:
+// line endings (text, eol, crlf), filters, $Id$ expansion
+// and encodings. Unset ("-text") and unspecified ("!text")
+// attributes don't
+func filterAttribute(attr string) bool {
+	if attr == "" || attr[0] == '-' || attr[0] == '!' {
+		return false
+	}
+
+	name, _, _ := strings.Cut(attr, "=")
+
+	switch name {
+	case "text", "eol", "crlf", "filter", "ident", "working-tree-encoding":
+		return true
+	}
+
+	return false
+}
+
+// untrackedWalker looks for untracked and ignored entries
+// in the work tree
+type untrackedWalker struct {
+	repo        *repository
+	tracked     map[string]bool
+	trackedDirs map[string]bool
+	entries     map[string]string
+}
+
+// Walks the directory 'prefix' (relative to the top level)
+// recording untracked and ignored entries
+func (w untrackedWalker) walk(prefix string) error {
+	rules := w.repo.dirIgnoreRules(w.repo.baseIgnoreRules(), "")
+
+	// Load the ignore files of the directories
+	// leading to 'prefix'
+	dir := ""
+	for _, name := range strings.Split(prefix, "/") {
+		if name == "" {
+			break
+		}
+
+		dir = path.Join(dir, name)
+
+		if !w.trackedDirs[dir] {
+			// 'prefix' is inside an untracked directory
+			w.untrackedDir(dir, rules)
+			return nil
+		}
+
+		rules = w.repo.dirIgnoreRules(rules, dir)
+	}
+
+	return w.walkDir(prefix, rules)
+}
+
+// Walks a directory containing tracked files
+func (w untrackedWalker) walkDir(dir string, rules ignoreRules) error {
+	list, err := os.ReadDir(filepath.Join(w.repo.workTree, filepath.FromSlash(dir)))
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range list {
+		if entry.Name() == ".git" {
+			continue
+		}
+
+		p := path.Join(dir, entry.Name())
+
+		if w.tracked[p] {
+			continue
+		}
+
+		if entry.IsDir() && w.trackedDirs[p] {
+			if err := w.walkDir(p, w.repo.dirIgnoreRules(rules, p)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if entry.IsDir() {
+			w.untrackedDir(p, rules)
+		} else if _, ok := w.entries[p]; ok {
+			// Deleted from the index, keep the staged change
+			continue
+		} else if rules.ignored(p, false) {
+			w.entries[p] = "!!"
+		} else {
+			w.entries[p] = "??"
+		}
+	}
+
+	return nil
+}
+
+// Records the status of a directory without tracked files
+// Like git, empty directories are not reported
+func (w untrackedWalker) untrackedDir(dir string, rules ignoreRules) {
+	if rules.ignored(dir, true) {
+		w.entries[dir+"/"] = "!!"
+		return
+	}
+
+	switch w.dirContent(dir, rules) {
+	case contentUntracked:
+		w.entries[dir+"/"] = "??"
+	case contentIgnored:
+		w.entries[dir+"/"] = "!!"
+	}
+}
+
+const (
+	contentEmpty = iota
+	contentIgnored
+	contentUntracked
+)
+
+// Returns whether an untracked directory contains
+// untracked files, only ignored ones, or nothing
+func (w untrackedWalker) dirContent(dir string, rules ignoreRules) int {
+	fullpath := filepath.Join(w.repo.workTree, filepath.FromSlash(dir))
+
+	// Nested repositories are reported as untracked directories
+	if _, err := os.Lstat(filepath.Join(fullpath, ".git")); err == nil {
+		return contentUntracked
+	}
+
+	list, err := os.ReadDir(fullpath)
+	if err != nil {
+		return contentEmpty
+	}
+
+	rules = w.repo.dirIgnoreRules(rules, dir)
+	content := contentEmpty
+
+	for _, entry := range list {
+		p := path.Join(dir, entry.Name())
+
+		if rules.ignored(p, entry.IsDir()) {
+			content = contentIgnored
+			continue
+		}
+
+		if !entry.IsDir() {
+			return contentUntracked
+		}
+
+		switch w.dirContent(p, rules) {
+		case contentUntracked:
+			return contentUntracked
+		case contentIgnored:
+			content = contentIgnored
+		}
+	}
+
+	return content
+}
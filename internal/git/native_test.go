@@ -0,0 +1,35 @@
+package git
+
+import "testing"
+
+func TestAttributesFilter(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"", false},
+		{"# text files get a filter\n", false},
+		{"*.png binary\n*.go diff=golang\n", false},
+		{"*.bin -text\n*.sh !eol\n*.txt -crlf\n", false},
+		{"docs/text.md linguist-documentation\n", false},
+		{"*.txt text\n", true},
+		{"* text=auto\n", true},
+		{"*.sh eol=lf\n", true},
+		{"*.bat crlf\n", true},
+		{"*.psd filter=lfs diff=lfs merge=lfs -text\n", true},
+		{"*.c ident\n", true},
+		{"*.txt working-tree-encoding=UTF-16\n", true},
+		{"*.c\tdiff\tident\n", true},
+		{"\"with space.txt\" text\n", true},
+		{"\"with text.bin\" -text\n", false},
+		{"[attr]lfs filter=lfs -text\n*.psd lfs\n", true},
+		{"[attr]lfs filter=lfs -text\n", false},
+		{"[attr]nodiff -diff\n*.psd nodiff\n", false},
+	}
+
+	for _, tt := range tests {
+		if got := attributesFilter(tt.content); got != tt.want {
+			t.Errorf("attributesFilter(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
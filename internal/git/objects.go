@@ -0,0 +1,395 @@
+package git
+
+// Reading commits and trees from the object database
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Object types, as numbered in pack files
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+var objTypeNames = map[string]int{
+	"commit": objCommit,
+	"tree":   objTree,
+	"blob":   objBlob,
+	"tag":    objTag,
+}
+
+// objectStore reads objects from the loose object
+// directories and pack files of a repository
+type objectStore struct {
+	dir   string
+	packs []*packFile
+	// Trees and commits are read several times while
+	// walking history, keep them around
+	cache map[string]object
+}
+
+type object struct {
+	kind int
+	data []byte
+}
+
+// Opens the object database of a repository, once
+// for all the callers, until the repository is closed
+// Repositories borrowing objects from alternates are not supported
+func (r *repository) objects() (*objectStore, error) {
+	if r.store != nil {
+		return r.store, nil
+	}
+
+	dir := filepath.Join(r.commonDir, "objects")
+
+	if _, err := os.Stat(filepath.Join(dir, "info", "alternates")); err == nil {
+		return nil, errUnsupported
+	}
+
+	store := &objectStore{dir: dir, cache: make(map[string]object)}
+
+	indexes, _ := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+	for _, idx := range indexes {
+		pack, err := openPack(strings.TrimSuffix(idx, ".idx"))
+		if err != nil {
+			return nil, err
+		}
+
+		store.packs = append(store.packs, pack)
+	}
+
+	r.store = store
+
+	return store, nil
+}
+
+// Close closes the pack files the store opened
+func (s *objectStore) Close() error {
+	var err error
+
+	for _, pack := range s.packs {
+		if closeErr := pack.close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// Reads an object given its hexadecimal id
+func (s *objectStore) read(oid string) (object, error) {
+	if obj, ok := s.cache[oid]; ok {
+		return obj, nil
+	}
+
+	obj, err := s.readLoose(oid)
+	if os.IsNotExist(err) {
+		var pack *packFile
+		var offset int64
+
+		if pack, offset, err = s.findPacked(oid); err == nil {
+			obj, err = pack.read(offset, s)
+		}
+	}
+
+	if err != nil {
+		return object{}, err
+	}
+
+	if obj.kind != objBlob {
+		s.cache[oid] = obj
+	}
+
+	return obj, nil
+}
+
+// Returns the size of an object, reading only its header
+func (s *objectStore) size(oid string) (int64, error) {
+	if obj, ok := s.cache[oid]; ok {
+		return int64(len(obj.data)), nil
+	}
+
+	f, err := s.openLoose(oid)
+	if err == nil {
+		defer f.Close()
+
+		_, size, _, err := readLooseHeader(f, oid)
+
+		return size, err
+	}
+
+	if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	pack, offset, err := s.findPacked(oid)
+	if err != nil {
+		return 0, err
+	}
+
+	return pack.size(offset)
+}
+
+// Returns the pack holding an object, and its offset in the pack
+func (s *objectStore) findPacked(oid string) (*packFile, int64, error) {
+	raw, err := hex.DecodeString(oid)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, pack := range s.packs {
+		if offset, ok := pack.find(raw); ok {
+			return pack, offset, nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("object %s not found", oid)
+}
+
+// Opens the file of a loose object
+func (s *objectStore) openLoose(oid string) (*os.File, error) {
+	if len(oid) != 40 {
+		return nil, fmt.Errorf("invalid object id %q", oid)
+	}
+
+	return os.Open(filepath.Join(s.dir, oid[:2], oid[2:]))
+}
+
+// Reads a loose object
+func (s *objectStore) readLoose(oid string) (object, error) {
+	f, err := s.openLoose(oid)
+	if err != nil {
+		return object{}, err
+	}
+	defer f.Close()
+
+	kind, size, r, err := readLooseHeader(f, oid)
+	if err != nil {
+		return object{}, err
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return object{}, fmt.Errorf("corrupt object %s", oid)
+	}
+
+	// Nothing may follow
+	if _, err := r.ReadByte(); err != io.EOF {
+		return object{}, fmt.Errorf("corrupt object %s", oid)
+	}
+
+	return object{kind, data}, nil
+}
+
+// Inflates the header of a loose object, "<type> <size>\0"
+// Returns the type, the size, and a reader of the content
+func readLooseHeader(f io.Reader, oid string) (int, int64, *bufio.Reader, error) {
+	z, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	r := bufio.NewReader(z)
+
+	header := []byte{}
+	for {
+		c, err := r.ReadByte()
+		if err != nil || len(header) > 32 {
+			return 0, 0, nil, fmt.Errorf("corrupt object %s", oid)
+		}
+
+		if c == 0 {
+			break
+		}
+
+		header = append(header, c)
+	}
+
+	kind, size, _ := strings.Cut(string(header), " ")
+
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 || objTypeNames[kind] == 0 {
+		return 0, 0, nil, fmt.Errorf("corrupt object %s", oid)
+	}
+
+	return objTypeNames[kind], n, r, nil
+}
+
+// commit holds the fields of a commit object k uses
+type commit struct {
+	tree    string
+	parents []string
+	// Name of the author
+	author string
+	// Committer date, in seconds since the epoch
+	time int64
+	// First paragraph of the message, on one line
+	subject string
+}
+
+// Returns the id of the object an annotated tag points to,
+// following tags of tags, or 'oid' if it is not a tag
+func (s *objectStore) peel(oid string) (string, error) {
+	for {
+		obj, err := s.read(oid)
+		if err != nil {
+			return "", err
+		}
+
+		if obj.kind != objTag {
+			return oid, nil
+		}
+
+		oid, _, _ = strings.Cut(strings.TrimPrefix(string(obj.data), "object "), "\n")
+	}
+}
+
+// Reads and parses a commit, peeling annotated tags
+func (s *objectStore) readCommit(oid string) (*commit, error) {
+	oid, err := s.peel(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := s.read(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj.kind != objCommit {
+		return nil, fmt.Errorf("%s is not a commit", oid)
+	}
+
+	c := &commit{}
+
+	headers, message, _ := strings.Cut(string(obj.data), "\n\n")
+	paragraph, _, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n\n")
+	c.subject = strings.ReplaceAll(trimAllSpaces(paragraph), "\n", " ")
+
+	for _, line := range strings.Split(headers, "\n") {
+		if t, ok := strings.CutPrefix(line, "tree "); ok {
+			c.tree = t
+		} else if p, ok := strings.CutPrefix(line, "parent "); ok {
+			c.parents = append(c.parents, p)
+		} else if author, ok := strings.CutPrefix(line, "author "); ok {
+			// "Name <email> <timestamp> <timezone>"
+			name, _, _ := strings.Cut(author, " <")
+			c.author = name
+		} else if committer, ok := strings.CutPrefix(line, "committer "); ok {
+			// "Name <email> <timestamp> <timezone>"
+			fields := strings.Fields(committer)
+			if len(fields) >= 2 {
+				c.time, _ = strconv.ParseInt(fields[len(fields)-2], 10, 64)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// treeEntry is one entry of a tree object
+type treeEntry struct {
+	mode uint32
+	name string
+	oid  string
+}
+
+// Reads and parses a tree object
+func (s *objectStore) readTree(oid string) ([]treeEntry, error) {
+	obj, err := s.read(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj.kind != objTree {
+		return nil, fmt.Errorf("%s is not a tree", oid)
+	}
+
+	entries := []treeEntry{}
+	data := obj.data
+
+	for len(data) > 0 {
+		header, rest, ok := bytes.Cut(data, []byte{0})
+		if !ok || len(rest) < sha1.Size {
+			return nil, fmt.Errorf("corrupt tree %s", oid)
+		}
+
+		mode, name, _ := strings.Cut(string(header), " ")
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt tree %s", oid)
+		}
+
+		entries = append(entries, treeEntry{uint32(m), name, hex.EncodeToString(rest[:sha1.Size])})
+		data = rest[sha1.Size:]
+	}
+
+	return entries, nil
+}
+
+// Flattens the tree 'oid' into 'files', keyed by full path,
+// only descending into the directory 'prefix' (relative to
+// the root of the tree, "" for everything)
+// 'base' is the path of the tree itself
+func (s *objectStore) flattenTree(oid string, base string, prefix string, files map[string]treeEntry) error {
+	entries, err := s.readTree(oid)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		p := entry.name
+		if base != "" {
+			p = base + "/" + entry.name
+		}
+
+		if !isUnder(p, prefix) && !isUnder(prefix, p) {
+			continue
+		}
+
+		if entry.mode == 040000 {
+			if err := s.flattenTree(entry.oid, p, prefix, files); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isUnder(p, prefix) {
+			entry.name = p
+			files[p] = entry
+		}
+	}
+
+	return nil
+}
+
+// Returns true if the path 'p' is 'dir' or inside of it
+// 'dir' being "" for the top level
+func isUnder(p string, dir string) bool {
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// Computes the object id git gives to a blob
+func hashBlob(data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(data))
+	h.Write(data)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,109 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadLoose(t *testing.T) {
+	dir := newFixture(t)
+
+	writeFiles(t, dir, map[string]string{
+		"empty":  "",
+		"text":   "some text\n",
+		"binary": "\x00\x01\x02\xff",
+		"large":  strings.Repeat("large enough to span several zlib blocks\n", 4096),
+		"dir/a":  "a",
+	})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "loose objects")
+	runGit(t, dir, "tag", "-a", "-m", "a tag", "v1")
+
+	oids := strings.Fields(runGit(t, dir, "rev-parse", "HEAD", "HEAD^{tree}", "HEAD:dir", "v1"))
+	for _, name := range []string{"empty", "text", "binary", "large", "dir/a"} {
+		oids = append(oids, trimAllSpaces(runGit(t, dir, "rev-parse", "HEAD:"+name)))
+	}
+
+	want := catFile(t, dir, oids)
+
+	store, err := openFixture(t, dir).objects()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, oid := range oids {
+		obj, err := store.readLoose(oid)
+		if err != nil {
+			t.Errorf("readLoose(%s): %v", oid, err)
+			continue
+		}
+
+		if obj.kind != want[oid].kind || !bytes.Equal(obj.data, want[oid].data) {
+			t.Errorf("readLoose(%s) = %d, %q, want %d, %q", oid, obj.kind, obj.data, want[oid].kind, want[oid].data)
+		}
+
+		if size, err := store.size(oid); err != nil || size != int64(len(want[oid].data)) {
+			t.Errorf("size(%s) = %d, %v, want %d", oid, size, err, len(want[oid].data))
+		}
+	}
+}
+
+func TestReadLooseErrors(t *testing.T) {
+	dir := newFixture(t)
+
+	store, err := openFixture(t, dir).objects()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oid := "0123456789012345678901234567890123456789"
+	filename := filepath.Join(store.dir, oid[:2], oid[2:])
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"size too large", "blob 10\x00short"},
+		{"size too small", "blob 1\x00longer"},
+		{"no header", "blob 5"},
+		{"bad size", "blob five\x00short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			z := zlib.NewWriter(&b)
+			z.Write([]byte(tt.content))
+			z.Close()
+
+			if err := os.WriteFile(filename, b.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := store.readLoose(oid); err == nil {
+				t.Errorf("readLoose(%q) succeeded", tt.content)
+			}
+		})
+	}
+
+	t.Run("not zlib", func(t *testing.T) {
+		if err := os.WriteFile(filename, []byte("blob 5\x00short"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.readLoose(oid); err == nil {
+			t.Error("readLoose succeeded")
+		}
+	})
+
+	if _, err := store.readLoose("ffffffffffffffffffffffffffffffffffffffff"); !os.IsNotExist(err) {
+		t.Errorf("readLoose of a missing object: %v, want not exist", err)
+	}
+}
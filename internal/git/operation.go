@@ -0,0 +1,120 @@
+package git
+
+// Kind of repository, operations in progress and stashes
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Names of the operations that can be in progress
+// in a repository, as git's prompt names them
+const (
+	OpRebase     = "REBASE"
+	OpAm         = "AM"
+	OpAmRebase   = "AM/REBASE"
+	OpMerge      = "MERGING"
+	OpCherryPick = "CHERRY-PICKING"
+	OpRevert     = "REVERTING"
+	OpBisect     = "BISECTING"
+)
+
+// Returns true if 'name' exists in 'dir'
+func exists(dir string, name string) bool {
+	_, err := os.Lstat(filepath.Join(dir, name))
+
+	return err == nil
+}
+
+// Reads a file holding a single number
+// Returns 0 if it can't
+func readNumber(filename string) int {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return 0
+	}
+
+	n, _ := strconv.Atoi(trimAllSpaces(string(b)))
+
+	return n
+}
+
+// Fills the kind, the operation in progress and the number
+// of stashes of the repository whose top level is 'dir'
+func (r *Repo) readState(dir string) {
+	gitDir, commonDir, err := gitDirs(dir)
+	if err != nil {
+		return
+	}
+
+	// Linked worktrees have their own git directory
+	// in <common dir>/worktrees/<name>
+	if gitDir != commonDir {
+		r.Kind = RepoWorktree
+		r.Worktree = filepath.Base(gitDir)
+	}
+
+	r.readOperation(gitDir)
+	r.Stashes = countStashes(commonDir)
+}
+
+// Detects the operation in progress from the files
+// git leaves in the git directory
+func (r *Repo) readOperation(gitDir string) {
+	rebaseDir := ""
+
+	switch {
+	case exists(gitDir, "rebase-merge"):
+		rebaseDir = filepath.Join(gitDir, "rebase-merge")
+		r.Operation = OpRebase
+		r.Step = readNumber(filepath.Join(rebaseDir, "msgnum"))
+		r.Total = readNumber(filepath.Join(rebaseDir, "end"))
+
+	case exists(gitDir, "rebase-apply"):
+		rebaseDir = filepath.Join(gitDir, "rebase-apply")
+		r.Step = readNumber(filepath.Join(rebaseDir, "next"))
+		r.Total = readNumber(filepath.Join(rebaseDir, "last"))
+
+		if exists(rebaseDir, "rebasing") {
+			r.Operation = OpRebase
+		} else if exists(rebaseDir, "applying") {
+			r.Operation = OpAm
+		} else {
+			r.Operation = OpAmRebase
+		}
+
+	case exists(gitDir, "MERGE_HEAD"):
+		r.Operation = OpMerge
+
+	case exists(gitDir, "CHERRY_PICK_HEAD"):
+		r.Operation = OpCherryPick
+
+	case exists(gitDir, "REVERT_HEAD"):
+		r.Operation = OpRevert
+
+	case exists(gitDir, "BISECT_LOG"):
+		r.Operation = OpBisect
+	}
+
+	// HEAD is detached during a rebase, show the branch being rebased
+	if rebaseDir != "" {
+		if b, err := os.ReadFile(filepath.Join(rebaseDir, "head-name")); err == nil {
+			if branch, ok := strings.CutPrefix(trimAllSpaces(string(b)), "refs/heads/"); ok {
+				r.Branch = branch
+			}
+		}
+	}
+}
+
+// Returns the number of stashes, from the reflog of refs/stash
+func countStashes(commonDir string) int {
+	b, err := os.ReadFile(filepath.Join(commonDir, "logs", "refs", "stash"))
+	if err != nil {
+		return 0
+	}
+
+	return bytes.Count(b, []byte{'\n'})
+}
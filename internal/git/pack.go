@@ -0,0 +1,385 @@
+package git
+
+// Reading objects from pack files
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+var errCorruptPack = errors.New("corrupt pack file")
+
+// packFile is a pack and its version 2 index
+type packFile struct {
+	path    string
+	file    *os.File
+	fanout  [256]uint32
+	oids    []byte
+	offsets []uint32
+	large   []uint64
+}
+
+// Reads the index of a pack
+// 'base' is the path of the pack without extension
+func openPack(base string) (*packFile, error) {
+	b, err := os.ReadFile(base + ".idx")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < 8+256*4 || !bytes.Equal(b[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(b[4:8]) != 2 {
+		// Version 1 indexes are long gone
+		return nil, errUnsupported
+	}
+
+	p := &packFile{path: base + ".pack"}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(b[8+i*4:])
+	}
+
+	n := int(p.fanout[255])
+	pos := 8 + 256*4
+
+	if len(b) < pos+n*(sha1.Size+4+4) {
+		return nil, errCorruptPack
+	}
+
+	p.oids = b[pos : pos+n*sha1.Size]
+	pos += n * sha1.Size
+	// Skip the CRC32s
+	pos += n * 4
+
+	p.offsets = make([]uint32, n)
+	for i := range p.offsets {
+		p.offsets[i] = binary.BigEndian.Uint32(b[pos+i*4:])
+	}
+	pos += n * 4
+
+	for ; pos+8 <= len(b)-2*sha1.Size; pos += 8 {
+		p.large = append(p.large, binary.BigEndian.Uint64(b[pos:]))
+	}
+
+	return p, nil
+}
+
+// Returns the offset of an object in the pack
+func (p *packFile) find(oid []byte) (int64, bool) {
+	lo := 0
+	if oid[0] > 0 {
+		lo = int(p.fanout[oid[0]-1])
+	}
+	hi := int(p.fanout[oid[0]])
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.oids[(lo+i)*sha1.Size:(lo+i+1)*sha1.Size], oid) >= 0
+	})
+
+	if i >= hi || !bytes.Equal(p.oids[i*sha1.Size:(i+1)*sha1.Size], oid) {
+		return 0, false
+	}
+
+	offset := p.offsets[i]
+	if offset&0x80000000 != 0 {
+		index := int(offset & 0x7fffffff)
+		if index >= len(p.large) {
+			return 0, false
+		}
+
+		return int64(p.large[index]), true
+	}
+
+	return int64(offset), true
+}
+
+// Reads the object at 'offset', resolving deltas
+// 'store' is used to look up the bases of ref deltas
+func (p *packFile) read(offset int64, store *objectStore) (object, error) {
+	f, err := p.open()
+	if err != nil {
+		return object{}, err
+	}
+
+	return p.readAt(f, offset, store, 0)
+}
+
+// Returns the size of the object at 'offset', reading
+// only the header of its entry, and of its delta, which
+// starts with the size of the object it rebuilds
+func (p *packFile) size(offset int64) (int64, error) {
+	f, err := p.open()
+	if err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+
+	kind, size, err := readEntryHeader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	switch kind {
+	case objCommit, objTree, objBlob, objTag:
+		return size, nil
+
+	case objOfsDelta:
+		// Skip the distance to the base
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			if c&0x80 == 0 {
+				break
+			}
+		}
+
+	case objRefDelta:
+		if _, err := r.Discard(sha1.Size); err != nil {
+			return 0, err
+		}
+
+	default:
+		return 0, fmt.Errorf("unknown object type %d in pack", kind)
+	}
+
+	z, err := zlib.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer z.Close()
+
+	// The size of the base, then the size of the result
+	header := make([]byte, 0, 20)
+	c := make([]byte, 1)
+	for sizes := 0; sizes < 2; {
+		if _, err := io.ReadFull(z, c); err != nil {
+			return 0, errCorruptPack
+		}
+
+		header = append(header, c[0])
+		if c[0]&0x80 == 0 {
+			sizes++
+		}
+	}
+
+	_, rest := deltaSize(header)
+	result, _ := deltaSize(rest)
+
+	return int64(result), nil
+}
+
+// Opens the pack on the first read, it stays
+// open until it is closed
+func (p *packFile) open() (*os.File, error) {
+	if p.file == nil {
+		f, err := os.Open(p.path)
+		if err != nil {
+			return nil, err
+		}
+
+		p.file = f
+	}
+
+	return p.file, nil
+}
+
+// Closes the pack, if it was opened
+func (p *packFile) close() error {
+	if p.file == nil {
+		return nil
+	}
+
+	err := p.file.Close()
+	p.file = nil
+
+	return err
+}
+
+// Reads the type and size of an entry of a pack
+// For deltas, the size is the size of the delta
+func readEntryHeader(r *bufio.Reader) (int, int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	kind := int(c>>4) & 7
+	size := int64(c & 0x0f)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= int64(c&0x7f) << shift
+	}
+
+	return kind, size, nil
+}
+
+func (p *packFile) readAt(f *os.File, offset int64, store *objectStore, depth int) (object, error) {
+	if depth > 64 {
+		return object{}, errCorruptPack
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+
+	kind, size, err := readEntryHeader(r)
+	if err != nil {
+		return object{}, err
+	}
+
+	var c byte
+	var base object
+
+	switch kind {
+	case objCommit, objTree, objBlob, objTag:
+		data, err := inflate(r, size)
+		return object{kind, data}, err
+
+	case objOfsDelta:
+		if c, err = r.ReadByte(); err != nil {
+			return object{}, err
+		}
+		distance := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = r.ReadByte(); err != nil {
+				return object{}, err
+			}
+			distance = ((distance + 1) << 7) | int64(c&0x7f)
+		}
+
+		if base, err = p.readAt(f, offset-distance, store, depth+1); err != nil {
+			return object{}, err
+		}
+
+	case objRefDelta:
+		oid := make([]byte, sha1.Size)
+		if _, err = io.ReadFull(r, oid); err != nil {
+			return object{}, err
+		}
+
+		if base, err = store.read(hex.EncodeToString(oid)); err != nil {
+			return object{}, err
+		}
+
+	default:
+		return object{}, fmt.Errorf("unknown object type %d in pack", kind)
+	}
+
+	delta, err := inflate(r, size)
+	if err != nil {
+		return object{}, err
+	}
+
+	data, err := applyDelta(base.data, delta)
+
+	return object{base.kind, data}, err
+}
+
+// Decompresses 'size' bytes of zlib data
+func inflate(r io.Reader, size int64) ([]byte, error) {
+	z, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(z, data)
+
+	return data, err
+}
+
+// Reads a little-endian base 128 size from a delta
+func deltaSize(delta []byte) (int, []byte) {
+	size, shift := 0, 0
+
+	for len(delta) > 0 {
+		c := delta[0]
+		delta = delta[1:]
+		size |= int(c&0x7f) << shift
+		shift += 7
+
+		if c&0x80 == 0 {
+			break
+		}
+	}
+
+	return size, delta
+}
+
+// Rebuilds an object from its base and a delta
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	baseSize, delta := deltaSize(delta)
+	if baseSize != len(base) {
+		return nil, errCorruptPack
+	}
+
+	size, delta := deltaSize(delta)
+	result := make([]byte, 0, size)
+
+	for len(delta) > 0 {
+		cmd := delta[0]
+		delta = delta[1:]
+
+		if cmd&0x80 != 0 {
+			// Copy from the base
+			var offset, length int
+
+			for i := 0; i < 4; i++ {
+				if cmd&(1<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errCorruptPack
+					}
+					offset |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+
+			for i := 0; i < 3; i++ {
+				if cmd&(0x10<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errCorruptPack
+					}
+					length |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+
+			if length == 0 {
+				length = 0x10000
+			}
+
+			if offset+length > len(base) {
+				return nil, errCorruptPack
+			}
+
+			result = append(result, base[offset:offset+length]...)
+		} else if cmd != 0 {
+			// Insert literal data
+			if int(cmd) > len(delta) {
+				return nil, errCorruptPack
+			}
+
+			result = append(result, delta[:cmd]...)
+			delta = delta[cmd:]
+		} else {
+			return nil, errCorruptPack
+		}
+	}
+
+	if len(result) != size {
+		return nil, errCorruptPack
+	}
+
+	return result, nil
+}
@@ -0,0 +1,347 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Encodes a size the way deltas start with them
+func deltaHeader(sizes ...int) []byte {
+	var b []byte
+
+	for _, size := range sizes {
+		for size >= 0x80 {
+			b = append(b, byte(size&0x7f)|0x80)
+			size >>= 7
+		}
+		b = append(b, byte(size))
+	}
+
+	return b
+}
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("0123456789abcdef")
+	large := bytes.Repeat([]byte("0123456789abcdef"), 0x1000+1)
+
+	concat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		name   string
+		base   []byte
+		delta  []byte
+		result string
+		err    error
+	}{
+		{
+			name:   "copy everything",
+			base:   base,
+			delta:  concat(deltaHeader(16, 16), []byte{0x90, 16}),
+			result: "0123456789abcdef",
+		},
+		{
+			name:   "copy from an offset",
+			base:   base,
+			delta:  concat(deltaHeader(16, 3), []byte{0x91, 4, 3}),
+			result: "456",
+		},
+		{
+			name:   "insert",
+			base:   base,
+			delta:  concat(deltaHeader(16, 3), []byte{3}, []byte("xyz")),
+			result: "xyz",
+		},
+		{
+			name:   "copies and inserts",
+			base:   base,
+			delta:  concat(deltaHeader(16, 9), []byte{0x91, 10, 3}, []byte{3}, []byte("-+-"), []byte{0x90, 3}),
+			result: "abc-+-012",
+		},
+		{
+			name:   "two byte offset",
+			base:   large,
+			delta:  concat(deltaHeader(len(large), 4), []byte{0x93, 0x02, 0x01, 4}),
+			result: "2345",
+		},
+		{
+			name:   "no length is 0x10000",
+			base:   large,
+			delta:  concat(deltaHeader(len(large), 0x10000), []byte{0x80}),
+			result: string(large[:0x10000]),
+		},
+		{
+			name:  "copy past the end of the base",
+			base:  base,
+			delta: concat(deltaHeader(16, 10), []byte{0x91, 10, 10}),
+			err:   errCorruptPack,
+		},
+		{
+			name:  "copy arguments cut short",
+			base:  base,
+			delta: concat(deltaHeader(16, 4), []byte{0x91, 10}),
+			err:   errCorruptPack,
+		},
+		{
+			name:  "insert cut short",
+			base:  base,
+			delta: concat(deltaHeader(16, 4), []byte{4}, []byte("xy")),
+			err:   errCorruptPack,
+		},
+		{
+			name:  "reserved opcode",
+			base:  base,
+			delta: concat(deltaHeader(16, 1), []byte{0}),
+			err:   errCorruptPack,
+		},
+		{
+			name:  "wrong base size",
+			base:  base,
+			delta: concat(deltaHeader(15, 3), []byte{3}, []byte("xyz")),
+			err:   errCorruptPack,
+		},
+		{
+			name:  "wrong result size",
+			base:  base,
+			delta: concat(deltaHeader(16, 4), []byte{3}, []byte("xyz")),
+			err:   errCorruptPack,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyDelta(tt.base, tt.delta)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if err == nil && string(result) != tt.result {
+				t.Errorf("result = %q, want %q", result, tt.result)
+			}
+		})
+	}
+}
+
+// packedObject is a line of `git verify-pack -v`
+type packedObject struct {
+	oid    string
+	kind   string
+	offset int64
+	delta  bool
+}
+
+// Lists the objects of a pack with `git verify-pack -v`
+func verifyPack(t *testing.T, dir string, idx string) []packedObject {
+	t.Helper()
+
+	objects := []packedObject{}
+
+	for _, line := range strings.Split(runGit(t, dir, "verify-pack", "-v", idx), "\n") {
+		// "<oid> <type> <size> <size in pack> <offset> [<depth> <base>]"
+		fields := strings.Fields(line)
+		if len(fields) < 5 || len(fields[0]) != 40 {
+			continue
+		}
+
+		offset, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			t.Fatalf("verify-pack: %q", line)
+		}
+
+		objects = append(objects, packedObject{fields[0], fields[1], offset, len(fields) > 5})
+	}
+
+	return objects
+}
+
+// Builds a repository whose history is in one pack, with deltas
+// Returns the path of the pack without extension
+func packFixture(t *testing.T, deltaBaseOffset bool) (string, string) {
+	t.Helper()
+
+	dir := newFixture(t)
+
+	lines := []string{}
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("line %d of a file long enough to be deltified", i))
+	}
+
+	for version := 0; version < 5; version++ {
+		lines[version*40] = fmt.Sprintf("changed in version %d", version)
+		writeFiles(t, dir, map[string]string{
+			"file.txt":     strings.Join(lines, "\n"),
+			"dir/file.txt": strings.Join(lines[version:], "\n"),
+		})
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "-q", "-m", fmt.Sprint("version ", version))
+	}
+	runGit(t, dir, "tag", "-a", "-m", "tag", "v1")
+
+	runGit(t, dir, "-c", fmt.Sprint("repack.usedeltabaseoffset=", deltaBaseOffset), "repack", "-a", "-d", "-f", "-q")
+
+	packs, _ := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.idx"))
+	if len(packs) != 1 {
+		t.Fatalf("%d packs, want 1", len(packs))
+	}
+
+	return dir, strings.TrimSuffix(packs[0], ".idx")
+}
+
+func TestPackFind(t *testing.T) {
+	dir, base := packFixture(t, true)
+
+	// Index the pack again, with every offset past 64
+	// bytes in the table of large offsets
+	reindexed := filepath.Join(t.TempDir(), "pack")
+	pack, err := os.ReadFile(base + ".pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(reindexed+".pack", pack, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "index-pack", "--index-version=2,64", "-o", reindexed+".idx", reindexed+".pack")
+
+	for _, b := range []string{base, reindexed} {
+		t.Run(filepath.Base(filepath.Dir(b)), func(t *testing.T) {
+			p, err := openPack(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			objects := verifyPack(t, dir, b+".idx")
+			if len(objects) == 0 {
+				t.Fatal("no objects in the pack")
+			}
+
+			large := 0
+			for _, obj := range objects {
+				raw, _ := hex.DecodeString(obj.oid)
+
+				offset, ok := p.find(raw)
+				if !ok || offset != obj.offset {
+					t.Errorf("find(%s) = %d, %v, want %d", obj.oid, offset, ok, obj.offset)
+				}
+
+				if obj.offset > 64 {
+					large++
+				}
+			}
+
+			if b == reindexed && len(p.large) != large {
+				t.Errorf("%d large offsets, want %d", len(p.large), large)
+			}
+
+			// Differs from a packed object in the last byte
+			near, _ := hex.DecodeString(objects[0].oid)
+			near[len(near)-1] ^= 1
+
+			for _, missing := range [][]byte{
+				bytes.Repeat([]byte{0x00}, 20),
+				bytes.Repeat([]byte{0xff}, 20),
+				near,
+			} {
+				if offset, ok := p.find(missing); ok {
+					t.Errorf("find(%x) = %d, want none", missing, offset)
+				}
+			}
+		})
+	}
+}
+
+// Reads objects with `git cat-file --batch`
+func catFile(t *testing.T, dir string, oids []string) map[string]object {
+	t.Helper()
+
+	out := runGitInput(t, dir, strings.Join(oids, "\n")+"\n", "cat-file", "--batch")
+	r := bufio.NewReader(strings.NewReader(out))
+	objects := make(map[string]object)
+
+	for range oids {
+		// "<oid> <type> <size>\n<content>\n"
+		header, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fields := strings.Fields(header)
+		size, _ := strconv.Atoi(fields[2])
+
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatal(err)
+		}
+
+		objects[fields[0]] = object{objTypeNames[fields[1]], data[:size]}
+	}
+
+	return objects
+}
+
+func TestPackRead(t *testing.T) {
+	for _, ofsDelta := range []bool{true, false} {
+		t.Run(fmt.Sprint("ofs-delta=", ofsDelta), func(t *testing.T) {
+			dir, base := packFixture(t, ofsDelta)
+
+			objects := verifyPack(t, dir, base+".idx")
+			oids := []string{}
+			deltas := 0
+			for _, obj := range objects {
+				oids = append(oids, obj.oid)
+				if obj.delta {
+					deltas++
+				}
+			}
+			if deltas == 0 {
+				t.Fatal("no deltas in the pack")
+			}
+
+			want := catFile(t, dir, oids)
+
+			store, err := openFixture(t, dir).objects()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, oid := range oids {
+				obj, err := store.read(oid)
+				if err != nil {
+					t.Errorf("read(%s): %v", oid, err)
+					continue
+				}
+
+				if obj.kind != want[oid].kind || !bytes.Equal(obj.data, want[oid].data) {
+					t.Errorf("read(%s) = %d, %d bytes, want %d, %d bytes", oid, obj.kind, len(obj.data), want[oid].kind, len(want[oid].data))
+				}
+			}
+
+			// Sizes come from the headers of the entries and deltas,
+			// without the cache of the objects read above
+			store.cache = make(map[string]object)
+			for _, oid := range oids {
+				if size, err := store.size(oid); err != nil || size != int64(len(want[oid].data)) {
+					t.Errorf("size(%s) = %d, %v, want %d", oid, size, err, len(want[oid].data))
+				}
+			}
+
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range store.packs {
+				if p.file != nil {
+					t.Errorf("%s is still open", p.path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package git
+
+// Reading HEAD, loose refs and packed-refs
+
+import (
+	"bufio"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Names of the refs that live at the top of the
+// git dir, next to HEAD
+var pseudoRef = regexp.MustCompile(`^[A-Z_]+$`)
+
+// Returns true if 's' is a full hexadecimal object id
+func isObjectID(s string) bool {
+	_, err := hex.DecodeString(s)
+
+	return err == nil && len(s) == 40
+}
+
+// Returns the directory holding the ref 'name'
+// Per-worktree refs (HEAD, and the pseudo refs next to it)
+// live in the git dir, the others in the common dir
+func (r *repository) refDir(name string) string {
+	if !strings.HasPrefix(name, "refs/") || strings.HasPrefix(name, "refs/bisect/") || strings.HasPrefix(name, "refs/worktree/") {
+		return r.gitDir
+	}
+
+	return r.commonDir
+}
+
+// Reads the value of a ref without following symbolic refs
+// Returns either "ref: <target>" or an object id
+// and false if the ref doesn't exist
+func (r *repository) readRef(name string) (string, bool) {
+	b, err := os.ReadFile(filepath.Join(r.refDir(name), filepath.FromSlash(name)))
+	if err == nil {
+		return trimAllSpaces(string(b)), true
+	}
+
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+
+		oid, ref, ok := strings.Cut(line, " ")
+		if ok && ref == name {
+			return oid, true
+		}
+	}
+
+	return "", false
+}
+
+// Resolves a ref to an object id, following symbolic refs
+// Returns the name of the last ref in the chain and its
+// object id (empty on an unborn branch)
+func (r *repository) resolveRef(name string) (string, string) {
+	for depth := 0; depth < 5; depth++ {
+		value, ok := r.readRef(name)
+		if !ok {
+			return name, ""
+		}
+
+		target, symbolic := strings.CutPrefix(value, "ref: ")
+		if !symbolic {
+			return name, value
+		}
+
+		name = trimAllSpaces(target)
+	}
+
+	return name, ""
+}
+
+// Returns the branch HEAD points to, or the abbreviated
+// commit id when HEAD is detached, the commit id, and
+// whether HEAD is detached
+func (r *repository) head() (string, string, bool) {
+	ref, oid := r.resolveRef("HEAD")
+
+	if ref == "HEAD" {
+		return shortHash(oid), oid, true
+	}
+
+	return strings.TrimPrefix(ref, "refs/heads/"), oid, false
+}
+
+// Resolves a revision given as a full commit id or as a ref
+// name, expanded the way git does ("main", "v1.0", "origin/main")
+// Returns errUnsupported for the other revision syntaxes
+// and for unknown names
+func (r *repository) resolveRevision(rev string) (string, error) {
+	if isObjectID(rev) {
+		return strings.ToLower(rev), nil
+	}
+
+	if rev == "" || strings.ContainsAny(rev, "~^:@{}\\ ") || strings.Contains(rev, "..") {
+		return "", errUnsupported
+	}
+
+	candidates := []string{}
+
+	// Like git, only full ref names and pseudo refs (HEAD,
+	// ORIG_HEAD…) are looked up as they are, so that
+	// "description" or "config" are not read from the git dir
+	if strings.HasPrefix(rev, "refs/") || pseudoRef.MatchString(rev) {
+		candidates = append(candidates, rev)
+	}
+
+	candidates = append(candidates,
+		"refs/"+rev,
+		"refs/tags/"+rev,
+		"refs/heads/"+rev,
+		"refs/remotes/"+rev,
+		"refs/remotes/"+rev+"/HEAD",
+	)
+
+	for _, name := range candidates {
+		_, oid := r.resolveRef(name)
+		if oid == "" {
+			continue
+		}
+
+		// FETCH_HEAD and the like hold more than an object id
+		if !isObjectID(oid) {
+			return "", errUnsupported
+		}
+
+		return oid, nil
+	}
+
+	return "", errUnsupported
+}
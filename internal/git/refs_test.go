@@ -0,0 +1,120 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackedRefs(t *testing.T) {
+	dir := newFixture(t)
+
+	for i, name := range []string{"one", "two", "three"} {
+		writeFiles(t, dir, map[string]string{"file": name})
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "-q", "-m", name)
+
+		runGit(t, dir, "branch", "branch-"+name)
+		runGit(t, dir, "tag", "light-"+name)
+		runGit(t, dir, "tag", "-a", "-m", name, "annotated-"+name)
+		if i == 0 {
+			runGit(t, dir, "tag", "-a", "-m", "tag of a tag", "nested", "annotated-one")
+		}
+	}
+
+	runGit(t, dir, "update-ref", "refs/remotes/origin/main", "HEAD~1")
+	runGit(t, dir, "pack-refs", "--all")
+
+	// A loose ref overrides its packed value
+	runGit(t, dir, "update-ref", "refs/heads/branch-one", "HEAD")
+
+	packed, err := os.ReadFile(filepath.Join(dir, ".git", "packed-refs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(packed), "\n^") {
+		t.Fatalf("no peeled lines in packed-refs:\n%s", packed)
+	}
+
+	r := openFixture(t, dir)
+	store, err := r.objects()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs := strings.Fields(runGit(t, dir, "for-each-ref", "--format=%(refname)"))
+	refs = append(refs, "HEAD", "refs/heads/missing")
+
+	for _, ref := range refs {
+		want := ""
+		peeled := ""
+		if ref != "refs/heads/missing" {
+			want = trimAllSpaces(runGit(t, dir, "rev-parse", ref))
+			peeled = trimAllSpaces(runGit(t, dir, "rev-parse", ref+"^{}"))
+		}
+
+		_, oid := r.resolveRef(ref)
+		if oid != want {
+			t.Errorf("resolveRef(%s) = %s, want %s", ref, oid, want)
+		}
+
+		if oid == "" {
+			continue
+		}
+
+		if got, err := store.peel(oid); err != nil || got != peeled {
+			t.Errorf("peel(%s) = %s, %v, want %s", ref, got, err, peeled)
+		}
+	}
+
+	for _, rev := range []string{"main", "branch-one", "light-two", "annotated-three", "origin/main", "origin"} {
+		want := ""
+		if rev != "origin" {
+			want = trimAllSpaces(runGit(t, dir, "rev-parse", rev))
+		}
+
+		got, err := r.resolveRevision(rev)
+		if want == "" {
+			if err == nil {
+				t.Errorf("resolveRevision(%s) = %s, want an error", rev, got)
+			}
+		} else if got != want {
+			t.Errorf("resolveRevision(%s) = %s, %v, want %s", rev, got, err, want)
+		}
+	}
+}
+
+func TestResolveRevisionGitDirFiles(t *testing.T) {
+	dir := newFixture(t)
+
+	writeFiles(t, dir, map[string]string{"file": "one"})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "one")
+	runGit(t, dir, "branch", "description")
+	runGit(t, dir, "branch", "config")
+
+	writeFiles(t, dir, map[string]string{"file": "two"})
+	runGit(t, dir, "commit", "-q", "-a", "-m", "two")
+	runGit(t, dir, "update-ref", "ORIG_HEAD", "HEAD~1")
+
+	// Written by git fetch, with more than the object id
+	head := trimAllSpaces(runGit(t, dir, "rev-parse", "HEAD"))
+	writeFiles(t, dir, map[string]string{".git/FETCH_HEAD": head + "\t\tbranch 'main' of ../origin\n"})
+
+	r := openFixture(t, dir)
+
+	// Branches named like files of the git dir
+	for _, rev := range []string{"description", "config", "ORIG_HEAD", "HEAD"} {
+		want := trimAllSpaces(runGit(t, dir, "rev-parse", rev))
+
+		if got, err := r.resolveRevision(rev); err != nil || got != want {
+			t.Errorf("resolveRevision(%s) = %s, %v, want %s", rev, got, err, want)
+		}
+	}
+
+	if got, err := r.resolveRevision("FETCH_HEAD"); !errors.Is(err, errUnsupported) {
+		t.Errorf("resolveRevision(FETCH_HEAD) = %s, %v, want errUnsupported", got, err)
+	}
+}
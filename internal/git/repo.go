@@ -0,0 +1,324 @@
+package git
+
+// Information about repositories listed from outside of them
+
+import (
+	"container/heap"
+	"strconv"
+	"strings"
+)
+
+// Kinds of repositories
+const (
+	// A regular repository, with a .git directory
+	RepoMain = iota
+	// A linked worktree, created by `git worktree add`
+	RepoWorktree
+	// A submodule of the listed repository
+	RepoSubmodule
+)
+
+// Repo describes a repository listed from
+// outside of its work tree, or a submodule
+type Repo struct {
+	// RepoMain, RepoWorktree or RepoSubmodule
+	Kind int
+	// Name of a linked worktree
+	Worktree string
+	// Submodules only: HEAD is at the commit
+	// recorded in the superproject
+	AtRecordedCommit bool
+	// "DG" if the repository has no pending changes,
+	// " M" if it is dirty
+	Status string
+	// Branch HEAD points to, or the abbreviated
+	// commit id when HEAD is detached
+	Branch string
+	// HEAD is not on a branch (checkout of a tag
+	// or commit, rebase in progress)
+	Detached bool
+	// Short name of the upstream branch ("origin/main"),
+	// empty when the branch has none
+	Upstream string
+	// The upstream is configured but its ref doesn't
+	// exist anymore (deleted on the remote and pruned)
+	UpstreamGone bool
+	// Number of commits the branch has that the upstream
+	// doesn't have, and the other way around
+	Ahead  int
+	Behind int
+	// Operation in progress (OpRebase, OpMerge…), empty if none
+	Operation string
+	// Progress of a rebase or am, 0 if unknown
+	Step  int
+	Total int
+	// Number of stash entries
+	Stashes int
+}
+
+// Fills the repository information from the headers of
+// `git status --porcelain=v2 --branch`
+func (r *Repo) parseBranchHeaders(headers map[string]string) {
+	r.Branch = headers["branch.head"]
+	if r.Branch == "(detached)" {
+		r.Branch = shortHash(headers["branch.oid"])
+		r.Detached = true
+	}
+
+	upstream, ok := headers["branch.upstream"]
+	if !ok {
+		return
+	}
+
+	r.Upstream = upstream
+
+	// The ahead/behind counts are missing when
+	// the upstream ref doesn't exist
+	ab, ok := headers["branch.ab"]
+	if !ok {
+		r.UpstreamGone = true
+		return
+	}
+
+	ahead, behind, _ := strings.Cut(ab, " ")
+	r.Ahead, _ = strconv.Atoi(strings.TrimPrefix(ahead, "+"))
+	r.Behind, _ = strconv.Atoi(strings.TrimPrefix(behind, "-"))
+}
+
+// Returns the full name of the upstream of a local branch
+// and its short name, from the branch.<name>.remote and
+// branch.<name>.merge settings
+// Both are empty if the branch has no upstream
+func (r *repository) upstream(branch string) (string, string) {
+	remote := r.config.get("branch."+branch+".remote", "")
+	merge := r.config.get("branch."+branch+".merge", "")
+
+	if remote == "" || merge == "" {
+		return "", ""
+	}
+
+	// Tracking a local branch
+	if remote == "." {
+		return merge, strings.TrimPrefix(merge, "refs/heads/")
+	}
+
+	// Map the remote branch to a remote-tracking branch with
+	// the fetch refspec of the remote ("+refs/heads/*:refs/remotes/origin/*")
+	refspec := r.config.get("remote."+remote+".fetch", "+refs/heads/*:refs/remotes/"+remote+"/*")
+	src, dst, ok := strings.Cut(strings.TrimPrefix(refspec, "+"), ":")
+	if !ok {
+		return "", ""
+	}
+
+	ref := ""
+	if srcPrefix, isGlob := strings.CutSuffix(src, "*"); isGlob {
+		if name, matches := strings.CutPrefix(merge, srcPrefix); matches {
+			ref = strings.TrimSuffix(dst, "*") + name
+		}
+	} else if src == merge {
+		ref = dst
+	}
+
+	if ref == "" {
+		return "", ""
+	}
+
+	return ref, strings.TrimPrefix(ref, "refs/remotes/")
+}
+
+// RemoteURL returns the URL of the remote the current branch of
+// the repository at 'dir' tracks, or of "origin", with the
+// selected backend
+// Empty when the repository has no such remote
+func RemoteURL(dir string) (string, error) {
+	return backend.RemoteURL(dir)
+}
+
+// nativeRemoteURL finds the URL of the remote of the
+// repository at 'dir' in its config files
+func nativeRemoteURL(dir string) (string, error) {
+	r, err := repositoryAt(dir)
+	if err != nil {
+		return "", err
+	}
+
+	defer r.close()
+
+	remote := "origin"
+	if branch, _, detached := r.head(); !detached {
+		if name := r.config.get("branch."+branch+".remote", ""); name != "" && name != "." {
+			remote = name
+		}
+	}
+
+	return r.config.get("remote."+remote+".url", ""), nil
+}
+
+// execRemoteURL asks git for the URL of the remote
+// of the repository at 'dir'
+func execRemoteURL(dir string) (string, error) {
+	remote := "origin"
+
+	// Fails with status 1 when HEAD is detached
+	out, err := runRepo(dir, "symbolic-ref", "-q", "--short", "HEAD")
+	if err == nil {
+		name, _ := runRepo(dir, "config", "--get", "branch."+trimAllSpaces(string(out))+".remote")
+		if name := trimAllSpaces(string(name)); name != "" && name != "." {
+			remote = name
+		}
+	} else if !isExitStatus(err, 1) {
+		return "", err
+	}
+
+	out, err = runRepo(dir, "config", "--get", "remote."+remote+".url")
+	if isExitStatus(err, 1) {
+		return "", nil
+	}
+
+	return trimAllSpaces(string(out)), err
+}
+
+// Fills the upstream information of a repository
+func (r *repository) tracking(repo *Repo, headOid string) error {
+	ref, name := r.upstream(repo.Branch)
+	if ref == "" {
+		return nil
+	}
+
+	repo.Upstream = name
+
+	_, upstreamOid := r.resolveRef(ref)
+	if upstreamOid == "" {
+		repo.UpstreamGone = true
+		return nil
+	}
+
+	if headOid == "" {
+		return nil
+	}
+
+	store, err := r.objects()
+	if err != nil {
+		return err
+	}
+
+	repo.Ahead, repo.Behind, err = store.aheadBehind(headOid, upstreamOid)
+
+	return err
+}
+
+// Flags used to paint commits when counting
+const (
+	fromLocal = 1 << iota
+	fromUpstream
+	// Reachable from both sides, and so are its ancestors
+	stale
+)
+
+type queuedCommit struct {
+	oid  string
+	time int64
+}
+
+// commitQueue is a priority queue of commits,
+// most recent first
+type commitQueue []queuedCommit
+
+func (q commitQueue) Len() int           { return len(q) }
+func (q commitQueue) Less(i, j int) bool { return q[i].time > q[j].time }
+func (q commitQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x any)        { *q = append(*q, x.(queuedCommit)) }
+func (q *commitQueue) Pop() any {
+	n := len(*q) - 1
+	c := (*q)[n]
+	*q = (*q)[:n]
+
+	return c
+}
+
+// Counts the commits reachable from 'local' but not from
+// 'upstream', and the other way around
+//
+// Like git, commits are walked from the most recent one,
+// painting them with the side they are reachable from, until
+// only commits reachable from both sides are left
+func (s *objectStore) aheadBehind(local string, upstream string) (int, int, error) {
+	flags := map[string]int{}
+	queue := &commitQueue{}
+
+	push := func(oid string, flag int) error {
+		if flags[oid]&flag == flag {
+			return nil
+		}
+
+		// A commit painted with a new flag is (re)queued
+		// so that its ancestors get painted too
+		flags[oid] |= flag
+		if flags[oid]&(fromLocal|fromUpstream) == fromLocal|fromUpstream {
+			flags[oid] |= stale
+		}
+
+		c, err := s.readCommit(oid)
+		if err != nil {
+			return err
+		}
+
+		heap.Push(queue, queuedCommit{oid, c.time})
+
+		return nil
+	}
+
+	if err := push(local, fromLocal); err != nil {
+		return 0, 0, err
+	}
+	if err := push(upstream, fromUpstream); err != nil {
+		return 0, 0, err
+	}
+
+	// Once every queued commit is reachable from both sides,
+	// only the commits already painted need to be walked,
+	// to mark the ones painted from one side only as stale
+	// (commits made in the same second can be walked in any order)
+	draining := false
+
+	for queue.Len() > 0 {
+		if !draining {
+			draining = true
+			for _, queued := range *queue {
+				if flags[queued.oid]&stale == 0 {
+					draining = false
+					break
+				}
+			}
+		}
+
+		oid := heap.Pop(queue).(queuedCommit).oid
+
+		c, err := s.readCommit(oid)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for _, parent := range c.parents {
+			if draining && flags[parent] == 0 {
+				continue
+			}
+
+			if err := push(parent, flags[oid]); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	ahead, behind := 0, 0
+	for _, flag := range flags {
+		switch flag {
+		case fromLocal:
+			ahead++
+		case fromUpstream:
+			behind++
+		}
+	}
+
+	return ahead, behind, nil
+}
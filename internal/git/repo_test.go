@@ -0,0 +1,96 @@
+package git
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRemoteURL(t *testing.T) {
+	dir := newFixture(t)
+
+	writeFiles(t, dir, map[string]string{"a.txt": "a"})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+
+	steps := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no remote", nil, ""},
+		{"origin", []string{"remote", "add", "origin", "git@github.com:gaelph/k.git"}, "git@github.com:gaelph/k.git"},
+		{"upstream", []string{"remote", "add", "fork", "https://example.com/fork.git"}, "git@github.com:gaelph/k.git"},
+		{"tracking", []string{"config", "branch.main.remote", "fork"}, "https://example.com/fork.git"},
+		{"tracking local", []string{"config", "branch.main.remote", "."}, "git@github.com:gaelph/k.git"},
+		{"detached", []string{"checkout", "-q", "--detach"}, "git@github.com:gaelph/k.git"},
+		{"no origin", []string{"remote", "remove", "origin"}, ""},
+	}
+
+	for _, step := range steps {
+		if step.args != nil {
+			runGit(t, dir, step.args...)
+		}
+
+		want, err := execRemoteURL(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := nativeRemoteURL(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want != step.want {
+			t.Errorf("%s: git returned %q, want %q", step.name, want, step.want)
+		}
+		if got != want {
+			t.Errorf("%s: RemoteURL = %q, want %q", step.name, got, want)
+		}
+	}
+
+	if _, err := execRemoteURL(t.TempDir()); err == nil {
+		t.Error("no error outside of a repository")
+	}
+}
+
+func TestRepoIgnoresSubmodules(t *testing.T) {
+	sub := newFixture(t)
+	writeFiles(t, sub, map[string]string{"f": "one"})
+	runGit(t, sub, "add", ".")
+	runGit(t, sub, "commit", "-q", "-m", "one")
+
+	dir := newFixture(t)
+	runGit(t, dir, "-c", "protocol.file.allow=always", "submodule", "add", "-q", sub, "s")
+	runGit(t, dir, "commit", "-q", "-m", "submodule")
+
+	steps := []struct {
+		name string
+		run  func()
+	}{
+		{"clean", func() {}},
+		{"changed files", func() { writeFiles(t, dir, map[string]string{"s/f": "two"}) }},
+		{"moved", func() { runGit(t, filepath.Join(dir, "s"), "commit", "-q", "-a", "-m", "two") }},
+		{"staged", func() { runGit(t, dir, "add", "s") }},
+	}
+
+	for _, step := range steps {
+		step.run()
+
+		want, err := execBackend{}.Repo(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := nativeRepo(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want.Status != "DG" {
+			t.Errorf("%s: git status = %q, want DG", step.name, want.Status)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Repo = %+v, want %+v", step.name, got, want)
+		}
+	}
+}
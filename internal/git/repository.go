@@ -0,0 +1,251 @@
+package git
+
+// Locating repositories on disk, without the git binary
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// repository describes the on-disk layout of a
+// non-bare repository
+type repository struct {
+	// Top level of the work tree
+	workTree string
+	// The .git directory (or the one a .git file points to)
+	gitDir string
+	// Directory holding the objects, refs and config,
+	// shared by all worktrees
+	commonDir string
+	config    config
+	// Opened by objects, closed by close
+	store *objectStore
+}
+
+// Reads the target of a ".git" file ("gitdir: <path>")
+func readGitFile(filename string) (string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	target, ok := strings.CutPrefix(trimAllSpaces(string(b)), "gitdir: ")
+	if !ok {
+		return "", errUnsupported
+	}
+
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(filename), target)
+	}
+
+	return filepath.Clean(target), nil
+}
+
+// Opens the repository whose work tree contains 'dir', found
+// like git finds it: with GIT_DIR and GIT_WORK_TREE when they
+// are set, relative to 'dir', and from the closest .git
+// directory or file above 'dir' otherwise
+//
+// The second return value is the path of 'dir' relative
+// to the top level of the work tree
+// Returns errNotInWorkTree if 'dir' is not in a work tree,
+// and errUnsupported for layouts the native backend
+// can't handle
+func findRepository(dir string) (*repository, string, error) {
+	for _, name := range repoEnv {
+		if name != "GIT_DIR" && name != "GIT_WORK_TREE" && os.Getenv(name) != "" {
+			return nil, "", errUnsupported
+		}
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	workTree := os.Getenv("GIT_WORK_TREE")
+	if workTree != "" {
+		workTree = absPath(abs, workTree)
+	}
+
+	var repo *repository
+
+	if gitDir := os.Getenv("GIT_DIR"); gitDir != "" {
+		// Unless the work tree is set, 'dir' is its top level
+		repo, err = openRepository(abs, absPath(abs, gitDir), workTree)
+	} else {
+		repo, err = discoverRepository(abs, workTree)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefix, err := filepath.Rel(repo.workTree, abs)
+	if err != nil || prefix == ".." || strings.HasPrefix(prefix, ".."+string(filepath.Separator)) {
+		return nil, "", errNotInWorkTree
+	}
+
+	if prefix == "." {
+		prefix = ""
+	}
+
+	return repo, filepath.ToSlash(prefix), nil
+}
+
+// Opens the repository of the closest .git directory
+// or file above 'dir'
+// 'workTree' is the value of GIT_WORK_TREE
+func discoverRepository(dir string, workTree string) (*repository, error) {
+	current := dir
+
+	for {
+		dotGit := filepath.Join(current, ".git")
+		info, err := os.Stat(dotGit)
+
+		if err == nil {
+			gitDir := dotGit
+
+			if !info.IsDir() {
+				if gitDir, err = readGitFile(dotGit); err != nil {
+					return nil, errUnsupported
+				}
+			}
+
+			return openRepository(current, gitDir, workTree)
+		}
+
+		// The git directory itself is not part of the work tree
+		if filepath.Base(current) == ".git" {
+			return nil, errNotInWorkTree
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return nil, errNotInWorkTree
+		}
+
+		current = parent
+	}
+}
+
+// Opens the repository whose top level is 'dir', ignoring
+// GIT_DIR and friends, for the repositories nested in a listing
+func repositoryAt(dir string) (*repository, error) {
+	gitDir, _, err := gitDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return openRepository(dir, gitDir, "")
+}
+
+// Resolves a path relative to 'dir'
+func absPath(dir string, p string) string {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+
+	return filepath.Clean(p)
+}
+
+// Returns the common directory of a git directory, the git
+// directory of the main worktree for linked worktrees
+func commonDirOf(gitDir string) string {
+	b, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+
+	commonDir := trimAllSpaces(string(b))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+
+	return filepath.Clean(commonDir)
+}
+
+// Returns the git directory and common directory of the
+// repository whose top level is 'dir', following .git files
+func gitDirs(dir string) (string, string, error) {
+	gitDir := filepath.Join(dir, ".git")
+
+	info, err := os.Stat(gitDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !info.IsDir() {
+		if gitDir, err = readGitFile(gitDir); err != nil {
+			return "", "", err
+		}
+	}
+
+	return gitDir, commonDirOf(gitDir), nil
+}
+
+// Opens a repository given its git directory
+// The top level of the work tree is 'workTree' if it is set
+// (from GIT_WORK_TREE), core.worktree if it is set, and
+// 'top' otherwise
+func openRepository(top string, gitDir string, workTree string) (*repository, error) {
+	commonDir := commonDirOf(gitDir)
+
+	c := config{}
+	for _, filename := range globalConfigFiles() {
+		c.load(filename)
+	}
+	c.load(filepath.Join(commonDir, "config"))
+
+	repo := &repository{
+		workTree:  top,
+		gitDir:    gitDir,
+		commonDir: commonDir,
+		config:    c,
+	}
+
+	if workTree == "" {
+		if wt := c.get("core.worktree", ""); wt != "" {
+			workTree = absPath(gitDir, wt)
+		} else if c.bool("core.bare", false) {
+			return nil, errNotInWorkTree
+		}
+	}
+
+	// Submodules set core.worktree to where their .git file is,
+	// keep the path we have when it's the same directory
+	if workTree != "" && !sameFile(workTree, top) {
+		repo.workTree = workTree
+	}
+
+	// SHA-256 repositories, and repository
+	// extensions we know nothing about
+	if c.get("extensions.objectformat", "sha1") != "sha1" {
+		return nil, errUnsupported
+	}
+	for key := range c {
+		if strings.HasPrefix(key, "extensions.") && key != "extensions.objectformat" && key != "extensions.worktreeconfig" {
+			return nil, errUnsupported
+		}
+	}
+
+	return repo, nil
+}
+
+// Closes the files of the repository that stay open,
+// once the caller is done with it
+func (r *repository) close() {
+	if r.store != nil {
+		r.store.Close()
+		r.store = nil
+	}
+}
+
+// Returns true if both paths point to the same file
+func sameFile(a string, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
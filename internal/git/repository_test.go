@@ -0,0 +1,130 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindRepository(t *testing.T) {
+	dir := newFixture(t)
+
+	writeFiles(t, dir, map[string]string{
+		"top.txt":     "top",
+		"sub/one.txt": "one",
+		"sub/two.txt": "two",
+	})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "files")
+	writeFiles(t, dir, map[string]string{
+		"sub/one.txt":      "changed",
+		"sub/untracked":    "",
+		"elsewhere/a/file": "",
+	})
+
+	// A git directory away from its work tree, found with core.worktree
+	detached := filepath.Join(t.TempDir(), "detached.git")
+	runGit(t, dir, "clone", "-q", "--bare", dir, detached)
+	runGit(t, detached, "config", "core.bare", "false")
+	runGit(t, detached, "config", "core.worktree", dir)
+
+	// A bare repository found from inside it
+	bare := filepath.Join(t.TempDir(), "bare.git")
+	runGit(t, dir, "init", "-q", "--bare", bare)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		dir  string
+		err  error
+	}{
+		{"top level", nil, dir, nil},
+		{"subdirectory", nil, filepath.Join(dir, "sub"), nil},
+		{"git dir", map[string]string{"GIT_DIR": filepath.Join(dir, ".git")}, filepath.Join(dir, "sub"), nil},
+		{"relative git dir", map[string]string{"GIT_DIR": "../.git"}, filepath.Join(dir, "sub"), nil},
+		{"work tree", map[string]string{"GIT_DIR": filepath.Join(dir, ".git"), "GIT_WORK_TREE": dir}, filepath.Join(dir, "sub"), nil},
+		{"relative work tree", map[string]string{"GIT_DIR": "../.git", "GIT_WORK_TREE": ".."}, filepath.Join(dir, "sub"), nil},
+		{"work tree without git dir", map[string]string{"GIT_WORK_TREE": filepath.Join(dir, "sub")}, filepath.Join(dir, "sub"), nil},
+		{"core.worktree", map[string]string{"GIT_DIR": detached}, filepath.Join(dir, "sub"), nil},
+		{"outside the work tree", map[string]string{"GIT_WORK_TREE": filepath.Join(dir, "sub")}, filepath.Join(dir, "elsewhere"), errNotInWorkTree},
+		{"bare", nil, bare, errNotInWorkTree},
+		{"git dir of a bare repository", map[string]string{"GIT_DIR": bare}, dir, errNotInWorkTree},
+		{"index file", map[string]string{"GIT_INDEX_FILE": filepath.Join(dir, ".git", "index")}, dir, errUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			r, prefix, err := findRepository(tt.dir)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+
+			if err != nil {
+				// git fails too, unless it can handle what we can't
+				if _, gitErr := (execBackend{}).Statuses(tt.dir, true); gitErr == nil && !errors.Is(err, errUnsupported) {
+					t.Errorf("git status succeeded")
+				}
+				return
+			}
+
+			defer r.close()
+
+			c := exec.Command("git", "rev-parse", "--show-toplevel", "--show-prefix")
+			c.Dir = tt.dir
+			out, err := c.Output()
+			if err != nil {
+				t.Fatalf("git rev-parse: %v", err)
+			}
+
+			lines := strings.Split(string(out), "\n")
+			if !sameFile(r.workTree, lines[0]) {
+				t.Errorf("work tree = %s, want %s", r.workTree, lines[0])
+			}
+			if want := strings.TrimSuffix(lines[1], "/"); prefix != want {
+				t.Errorf("prefix = %q, want %q", prefix, want)
+			}
+
+			native, err := nativeStatuses(tt.dir, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := execBackend{}.Statuses(tt.dir, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(native.entries, want.entries) {
+				t.Errorf("statuses = %v, want %v", native.entries, want.entries)
+			}
+		})
+	}
+}
+
+func TestRepositoryAt(t *testing.T) {
+	dir := newFixture(t)
+	other := newFixture(t)
+
+	// Nested repositories ignore the environment
+	t.Setenv("GIT_DIR", filepath.Join(other, ".git"))
+
+	r, err := repositoryAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+
+	if r.workTree != dir || r.gitDir != filepath.Join(dir, ".git") {
+		t.Errorf("repositoryAt(%s) = %s, %s", dir, r.workTree, r.gitDir)
+	}
+
+	if _, err := repositoryAt(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("repositoryAt of a missing directory: %v", err)
+	}
+}
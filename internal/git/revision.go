@@ -0,0 +1,222 @@
+package git
+
+// Listing a directory as of a given revision
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RevEntry is an entry of a directory at a given revision
+type RevEntry struct {
+	Name string
+	// Mode recorded by git: 100644, 100755 (executable),
+	// 120000 (symlink), 040000 (directory), 160000 (submodule)
+	Mode uint32
+	Oid  string
+	// Size of files and symlinks
+	Size int64
+	// Target of symlinks
+	Target string
+}
+
+// Revision is the content of a directory at a given revision
+type Revision struct {
+	// Commit the revision resolves to
+	Commit string
+	// Committer date of the commit
+	Time    time.Time
+	Entries []RevEntry
+}
+
+// LoadRevision lists the directory 'dir' as of the
+// revision 'rev' ("v1.0", "main", a commit id…),
+// with the selected backend
+func LoadRevision(dir string, rev string) (*Revision, error) {
+	if strings.HasPrefix(rev, "-") {
+		return nil, fmt.Errorf("invalid revision %q", rev)
+	}
+
+	return backend.Revision(dir, rev)
+}
+
+// Lists a revision with `git ls-tree -l`, reading
+// the targets of symlinks with `git cat-file --batch`
+func execRevision(dir string, rev string) (*Revision, error) {
+	out, err := run(dir, "-c", "log.showSignature=false", "log", "--no-show-signature", "-1", "--format=%H%x00%ct", rev, "--")
+	if err != nil {
+		return nil, fmt.Errorf("unknown revision %q", rev)
+	}
+
+	oid, seconds, _ := strings.Cut(trimAllSpaces(string(out)), "\x00")
+	timestamp, _ := strconv.ParseInt(seconds, 10, 64)
+
+	revision := &Revision{Commit: oid, Time: time.Unix(timestamp, 0)}
+
+	// "<mode> <type> <oid> <size>\t<name>\0", the
+	// size being "-" for directories and submodules
+	out, err = run(dir, "ls-tree", "-l", "-z", oid)
+	if err != nil {
+		return nil, err
+	}
+
+	symlinks := []string{}
+
+	for _, record := range strings.Split(string(out), "\x00") {
+		info, name, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(info)
+		if len(fields) != 4 {
+			continue
+		}
+
+		mode, _ := strconv.ParseUint(fields[0], 8, 32)
+		size, _ := strconv.ParseInt(fields[3], 10, 64)
+
+		revision.Entries = append(revision.Entries, RevEntry{
+			Name: name,
+			Mode: uint32(mode),
+			Oid:  fields[2],
+			Size: size,
+		})
+
+		if mode == 0120000 {
+			symlinks = append(symlinks, fields[2])
+		}
+	}
+
+	if len(symlinks) == 0 {
+		return revision, nil
+	}
+
+	targets, err := execCatFile(dir, symlinks)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, entry := range revision.Entries {
+		if entry.Mode == 0120000 {
+			revision.Entries[i].Target = targets[entry.Oid]
+		}
+	}
+
+	return revision, nil
+}
+
+// Reads the content of blobs, by object id, in a
+// single `git cat-file --batch` call
+func execCatFile(dir string, oids []string) (map[string]string, error) {
+	c := exec.Command("git", "cat-file", "--batch")
+	c.Dir = dir
+	c.Stdin = strings.NewReader(strings.Join(oids, "\n") + "\n")
+
+	out, err := c.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make(map[string]string)
+
+	// "<oid> <type> <size>\n<content>\n" for each object
+	for len(out) > 0 {
+		header, rest, ok := bytes.Cut(out, []byte("\n"))
+		if !ok {
+			break
+		}
+
+		fields := strings.Fields(string(header))
+		if len(fields) != 3 {
+			// "<oid> missing"
+			out = rest
+			continue
+		}
+
+		size, err := strconv.Atoi(fields[2])
+		if err != nil || size > len(rest) {
+			return nil, fmt.Errorf("unexpected git cat-file output")
+		}
+
+		contents[fields[0]] = string(rest[:size])
+		out = bytes.TrimPrefix(rest[size:], []byte("\n"))
+	}
+
+	return contents, nil
+}
+
+// Lists a revision from the object database
+// Only full commit ids and ref names are resolved,
+// other revisions ("HEAD~2", "v1.0^{}"…) are left to git
+func nativeRevision(dir string, rev string) (*Revision, error) {
+	r, prefix, err := findRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.close()
+
+	oid, err := r.resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := r.objects()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := store.readCommit(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Peeled, when 'rev' is an annotated tag
+	oid, err = store.peel(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := &Revision{Commit: oid, Time: time.Unix(c.time, 0)}
+
+	tree, err := store.subtree(c.tree, prefix)
+	if err != nil || tree == "" {
+		return revision, err
+	}
+
+	entries, err := store.readTree(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		e := RevEntry{Name: entry.name, Mode: entry.mode, Oid: entry.oid}
+
+		switch entry.mode {
+		case 040000, 0160000:
+			// Directories and submodules have no size
+		case 0120000:
+			obj, err := store.read(entry.oid)
+			if err != nil {
+				return nil, err
+			}
+
+			e.Size = int64(len(obj.data))
+			e.Target = string(obj.data)
+		default:
+			// Blobs are not read, only their header
+			if e.Size, err = store.size(entry.oid); err != nil {
+				return nil, err
+			}
+		}
+
+		revision.Entries = append(revision.Entries, e)
+	}
+
+	return revision, nil
+}
@@ -0,0 +1,63 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRevision(t *testing.T) {
+	dir := newFixture(t)
+
+	writeFiles(t, dir, map[string]string{
+		"small.txt":       "small",
+		"large.txt":       strings.Repeat("large file content\n", 2000),
+		"dir/nested.txt":  "nested",
+		"dir/deeper/file": "deeper",
+	})
+	if err := os.Symlink("small.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	runGit(t, dir, "tag", "-a", "-m", "v1", "v1")
+
+	writeFiles(t, dir, map[string]string{
+		"large.txt":      strings.Repeat("large file content\n", 2001),
+		"dir/nested.txt": "changed",
+	})
+	runGit(t, dir, "add", ".")
+	commitSigned(t, dir, "second")
+	runGit(t, dir, "config", "log.showSignature", "true")
+
+	// Packed, with deltas, and loose
+	runGit(t, dir, "repack", "-a", "-d", "-q")
+	writeFiles(t, dir, map[string]string{"loose.txt": "loose"})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "third")
+
+	for _, rev := range []string{"main", "v1", trimAllSpaces(runGit(t, dir, "rev-parse", "HEAD~1"))} {
+		for _, sub := range []string{"", "dir"} {
+			path := filepath.Join(dir, sub)
+
+			want, err := execRevision(path, rev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := nativeRevision(path, rev)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(want.Entries) == 0 {
+				t.Fatalf("no entries in %s at %s", path, rev)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s at %s = %+v, want %+v", path, rev, got, want)
+			}
+		}
+	}
+}
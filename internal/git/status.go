@@ -0,0 +1,420 @@
+package git
+
+// Batched git status for a whole directory listing
+
+import (
+	"bytes"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Statuses holds the status of every changed path below
+// a directory, as reported by a single
+// `git status --porcelain=v2` call
+type Statuses struct {
+	// Directory the statuses were collected for
+	dir string
+	// Path of 'dir' relative to the top level of the work tree
+	prefix string
+	// XY codes keyed by path relative to the top level,
+	// untracked and ignored directories end with a "/"
+	entries map[string]string
+	// Aggregated XY codes of the directories
+	// containing changes, keyed like 'entries'
+	// without the trailing "/"
+	dirs map[string]string
+	// The distinct XY codes of each path and of the
+	// paths below it, keyed like 'dirs'
+	codes map[string]map[string]bool
+	// Submodule state ("S<c><m><u>") of the changed
+	// submodules, keyed like 'entries'
+	submodules map[string]string
+	// Paths of all the submodules of the repository,
+	// from .gitmodules
+	gitmodules map[string]bool
+}
+
+// LoadStatuses collects the git status of every entry
+// below 'dir' at once, with the selected backend
+// Ignored entries are left out unless 'ignored' is true
+//
+// Returns an error if 'dir' is not inside a git work tree
+func LoadStatuses(dir string, ignored bool) (*Statuses, error) {
+	return backend.Statuses(dir, ignored)
+}
+
+func newStatuses(dir string, prefix string, p *porcelain) *Statuses {
+	s := &Statuses{
+		dir:        dir,
+		prefix:     prefix,
+		entries:    p.entries,
+		dirs:       make(map[string]string),
+		codes:      make(map[string]map[string]bool),
+		submodules: p.submodules,
+		gitmodules: make(map[string]bool),
+	}
+
+	c := config{}
+	c.load(filepath.Join(s.topLevel(), ".gitmodules"))
+	for key, value := range c {
+		if strings.HasPrefix(key, "submodule.") && strings.HasSuffix(key, ".path") {
+			s.gitmodules[strings.Trim(filepath.ToSlash(value), "/")] = true
+		}
+	}
+
+	for p, status := range s.entries {
+		d := strings.TrimSuffix(p, "/")
+		s.addCode(d, status)
+
+		for d != "" {
+			d = parentDir(d)
+			s.dirs[d] = mergeStatus(s.dirs[d], status)
+			s.addCode(d, status)
+		}
+	}
+
+	return s
+}
+
+// Records that 'status' is the code of 'p' or of a path below it
+func (s *Statuses) addCode(p string, status string) {
+	if s.codes[p] == nil {
+		s.codes[p] = make(map[string]bool)
+	}
+
+	s.codes[p][status] = true
+}
+
+// Returns the parent of a path relative to the top level,
+// the top level itself being ""
+func parentDir(p string) string {
+	d := path.Dir(p)
+	if d == "." {
+		return ""
+	}
+
+	return d
+}
+
+// porcelain holds what `git status --porcelain=v2` reports
+type porcelain struct {
+	// XY code of every path (with "." replaced by " " like
+	// in the v1 format), relative to the top level
+	entries map[string]string
+	// The "# key value" headers
+	headers map[string]string
+	// Submodule state ("S<c><m><u>") of changed submodules
+	submodules map[string]string
+}
+
+func newPorcelain() *porcelain {
+	return &porcelain{
+		entries:    make(map[string]string),
+		headers:    make(map[string]string),
+		submodules: make(map[string]string),
+	}
+}
+
+// Parses the output of `git status --porcelain=v2 -z`
+func parsePorcelain(out []byte) *porcelain {
+	p := newPorcelain()
+	entries := p.entries
+
+	records := bytes.Split(out, []byte{0})
+
+	for i := 0; i < len(records); i++ {
+		record := string(records[i])
+		if len(record) < 2 {
+			continue
+		}
+
+		switch record[0] {
+		case '#':
+			key, value, _ := strings.Cut(record[2:], " ")
+			p.headers[key] = value
+
+		case '?':
+			// A path deleted from the index but still in the
+			// work tree is reported twice, keep the staged change
+			if _, ok := entries[record[2:]]; !ok {
+				entries[record[2:]] = "??"
+			}
+
+		case '!':
+			entries[record[2:]] = "!!"
+
+		case '1', '2', 'u':
+			// Number of space separated fields before the path
+			fields := 8
+			if record[0] == '2' {
+				fields = 9
+			} else if record[0] == 'u' {
+				fields = 10
+			}
+
+			parts := strings.SplitN(record, " ", fields+1)
+			if len(parts) <= fields {
+				continue
+			}
+
+			entries[parts[fields]] = strings.ReplaceAll(parts[1], ".", " ")
+
+			if strings.HasPrefix(parts[2], "S") {
+				p.submodules[parts[fields]] = parts[2]
+			}
+
+			// Renames and copies are followed by the original path
+			if record[0] == '2' {
+				i++
+			}
+		}
+	}
+
+	return p
+}
+
+// Returns true if an XY code describes an unmerged path
+func IsConflict(status string) bool {
+	switch status {
+	case "DD", "AU", "UD", "UA", "DU", "AA", "UU":
+		return true
+	}
+
+	return false
+}
+
+// Combines the status of a directory's child into the
+// aggregated status of the directory
+//
+// "UU" -> one of the children is in conflict
+// "M " -> some children have staged changes
+// " M" -> some children have unstaged changes or are untracked
+// "MM" -> both
+func mergeStatus(agg string, status string) string {
+	if agg == "" {
+		agg = "  "
+	}
+
+	if agg == "UU" || IsConflict(status) {
+		return "UU"
+	}
+
+	if status == "!!" {
+		return agg
+	}
+
+	x, y := agg[0], agg[1]
+
+	if status[0] != ' ' && status[0] != '?' {
+		x = 'M'
+	}
+
+	if status[1] != ' ' {
+		y = 'M'
+	}
+
+	return string([]byte{x, y})
+}
+
+// Returns the absolute path to the top level of the work tree
+func (s *Statuses) topLevel() string {
+	top := s.dir
+
+	for p := s.prefix; p != ""; p = parentDir(p) {
+		top = filepath.Dir(top)
+	}
+
+	return top
+}
+
+// Returns the path of 'fullpath' relative to the top level
+// The second return value is false if 'fullpath' is outside
+// of the work tree
+func (s *Statuses) relative(fullpath string) (string, bool) {
+	rel, err := filepath.Rel(s.dir, fullpath)
+	if err != nil {
+		return "", false
+	}
+
+	rel = path.Join(s.prefix, filepath.ToSlash(rel))
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+
+	if rel == "." {
+		rel = ""
+	}
+
+	return rel, true
+}
+
+// Returns the status of the closest untracked or ignored
+// directory containing 'rel', if any
+func (s *Statuses) ancestorStatus(rel string) (string, bool) {
+	for rel != "" {
+		rel = parentDir(rel)
+
+		if status, ok := s.entries[rel+"/"]; ok {
+			return status, true
+		}
+	}
+
+	return "", false
+}
+
+// Returns status of a file inside a git repo
+func (s *Statuses) FileStatus(fullpath string) string {
+	rel, ok := s.relative(fullpath)
+	if !ok {
+		return "--"
+	}
+
+	if status, ok := s.entries[rel]; ok {
+		return status
+	}
+
+	if status, ok := s.ancestorStatus(rel); ok {
+		return status
+	}
+
+	return "  "
+}
+
+// Returns status of a directory inside a git repo
+// "  " -> no changes
+// "!!" -> ignored
+// "??" -> untracked
+// otherwise the aggregated status of its children
+// (see mergeStatus)
+func (s *Statuses) DirectoryStatus(fullpath string) string {
+	rel, ok := s.relative(fullpath)
+	if !ok {
+		return "--"
+	}
+
+	// Untracked or ignored directories, and submodules
+	if status, ok := s.entries[rel+"/"]; ok {
+		return status
+	}
+	if status, ok := s.entries[rel]; ok && rel != "" {
+		return status
+	}
+
+	if status, ok := s.ancestorStatus(rel); ok {
+		return status
+	}
+
+	if status, ok := s.dirs[rel]; ok {
+		return status
+	}
+
+	return "  "
+}
+
+// Returns true if the directory 'fullpath' is a submodule
+func (s *Statuses) IsSubmodule(fullpath string) bool {
+	rel, ok := s.relative(fullpath)
+
+	return ok && rel != "" && s.gitmodules[rel]
+}
+
+// Returns true if the submodule at 'fullpath' is checked
+// out at the commit recorded in the superproject
+func (s *Statuses) AtRecordedCommit(fullpath string) bool {
+	rel, ok := s.relative(fullpath)
+	if !ok {
+		return false
+	}
+
+	// "S<c><m><u>", c is "C" when the commit changed
+	state, changed := s.submodules[rel]
+
+	return !changed || len(state) < 2 || state[1] != 'C'
+}
+
+// Returns the names of the entries directly inside the
+// listed directory that have deleted paths, and whether
+// the deleted paths are inside of them (the entry
+// is a directory) or the entry itself
+//
+// Entries still on disk are returned too, callers are
+// expected to only keep the missing ones
+func (s *Statuses) Deleted() map[string]bool {
+	deleted := make(map[string]bool)
+
+	for p, status := range s.entries {
+		if !strings.ContainsRune(status, 'D') || p == s.prefix || !isUnder(p, s.prefix) {
+			continue
+		}
+
+		rest := p
+		if s.prefix != "" {
+			rest = strings.TrimPrefix(p, s.prefix+"/")
+		}
+
+		name, _, isDir := strings.Cut(rest, "/")
+		deleted[name] = deleted[name] || isDir
+	}
+
+	return deleted
+}
+
+// Returns true if 'match' returns true for the XY code of
+// 'fullpath', or for the code of any path below it when
+// 'fullpath' is a directory
+// Clean paths have no code and never match
+func (s *Statuses) AnyStatus(fullpath string, match func(status string) bool) bool {
+	rel, ok := s.relative(fullpath)
+	if !ok {
+		return false
+	}
+
+	// Inside of an untracked or ignored directory
+	if status, ok := s.ancestorStatus(rel); ok {
+		return match(status)
+	}
+
+	for status := range s.codes[rel] {
+		if match(status) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StatusCounts counts the changed paths below a directory
+type StatusCounts struct {
+	Staged     int
+	Unstaged   int
+	Untracked  int
+	Conflicted int
+}
+
+// Counts the paths with staged changes, with unstaged changes,
+// untracked and conflicted, like `git status` lists them:
+// a path can be both staged and unstaged, untracked
+// directories count as one
+func (s *Statuses) Counts() StatusCounts {
+	counts := StatusCounts{}
+
+	for _, status := range s.entries {
+		switch {
+		case status == "!!":
+		case status == "??":
+			counts.Untracked++
+		case IsConflict(status):
+			counts.Conflicted++
+		default:
+			if status[0] != ' ' {
+				counts.Staged++
+			}
+			if status[1] != ' ' {
+				counts.Unstaged++
+			}
+		}
+	}
+
+	return counts
+}
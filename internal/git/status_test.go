@@ -0,0 +1,52 @@
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnyStatus(t *testing.T) {
+	dir := t.TempDir()
+
+	p := newPorcelain()
+	for path, status := range map[string]string{
+		"a.txt":       " M",
+		"src/b.go":    "M ",
+		"src/c.go":    "A ",
+		"src/lib/d.c": "UU",
+		"build/":      "!!",
+		"new/":        "??",
+		"docs/e.md":   "D ",
+	} {
+		p.entries[path] = status
+	}
+
+	s := newStatuses(dir, "", p)
+
+	codes := []string{" M", "M ", "A ", "UU", "!!", "??", "D "}
+	paths := []string{"", "a.txt", "src", "src/b.go", "src/lib", "src/lib/d.c", "build", "build/out/f.o", "new", "new/g", "docs", "clean.txt", "clean"}
+
+	for _, rel := range paths {
+		for _, code := range codes {
+			match := func(status string) bool { return status == code }
+
+			// Every entry at or below the path, or its
+			// untracked or ignored ancestor
+			want := false
+			if status, ok := s.ancestorStatus(rel); ok {
+				want = status == code
+			} else {
+				for p, status := range p.entries {
+					if isUnder(strings.TrimSuffix(p, "/"), rel) && status == code {
+						want = true
+					}
+				}
+			}
+
+			if got := s.AnyStatus(filepath.Join(dir, filepath.FromSlash(rel)), match); got != want {
+				t.Errorf("AnyStatus(%q, %q) = %v, want %v", rel, code, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package lscolors
+
+// File name colors of GNU ls ($LS_COLORS) and BSD ls ($LSCOLORS)
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Colors maps the kinds of files, and file name
+// patterns, to SGR parameters ("01;34")
+type Colors struct {
+	// By two letter key: di, ln, ex…
+	kinds map[string]string
+	// By glob ("*.go"), the last ones taking precedence
+	patterns []pattern
+}
+
+type pattern struct {
+	glob string
+	sgr  string
+}
+
+// Entry is what a file name is colored after
+type Entry struct {
+	Name string
+	// As returned by lstat
+	Mode os.FileMode
+	// Number of hard links, 0 when unknown
+	Links uint64
+	// Whether the file has capabilities, only
+	// worth checking when Enabled("ca")
+	Capable bool
+	// Symlinks only: their target, whether
+	// it is missing, and its mode otherwise
+	Target     string
+	Orphan     bool
+	TargetMode os.FileMode
+}
+
+// Colors GNU ls uses for the kinds LS_COLORS leaves out
+var gnuDefaults = map[string]string{
+	"di": "01;34",
+	"ln": "01;36",
+	"pi": "33",
+	"so": "01;35",
+	"do": "01;35",
+	"bd": "01;33",
+	"cd": "01;33",
+	"ex": "01;32",
+	"su": "37;41",
+	"sg": "30;43",
+	"tw": "30;42",
+	"ow": "34;42",
+	"st": "37;44",
+}
+
+// Kinds LSCOLORS sets, in order, and its default value
+var bsdKinds = []string{"di", "ln", "so", "pi", "ex", "bd", "cd", "su", "sg", "tw", "ow"}
+
+const bsdDefault = "exfxcxdxbxegedabagacad"
+
+// FromEnvironment returns the colors of $LS_COLORS, or of
+// $LSCOLORS, nil when neither variable is set
+func FromEnvironment() *Colors {
+	if s := os.Getenv("LS_COLORS"); s != "" {
+		return Parse(s)
+	}
+
+	if s := os.Getenv("LSCOLORS"); s != "" {
+		return ParseBSD(s)
+	}
+
+	return nil
+}
+
+// Parse reads colors in the format of GNU
+// $LS_COLORS: "di=01;34:ln=01;36:*.go=33:…"
+func Parse(s string) *Colors {
+	c := &Colors{kinds: make(map[string]string)}
+
+	for key, sgr := range gnuDefaults {
+		c.kinds[key] = sgr
+	}
+
+	for _, field := range strings.Split(s, ":") {
+		if key, sgr, ok := strings.Cut(field, "="); ok {
+			c.set(key, sgr)
+		}
+	}
+
+	return c
+}
+
+// New returns colors keyed like the ones of $LS_COLORS
+// ("di", "*.go"…), without the defaults of GNU ls
+func New(kinds map[string]string) *Colors {
+	c := &Colors{kinds: make(map[string]string)}
+
+	keys := make([]string, 0, len(kinds))
+	for key := range kinds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		c.set(key, kinds[key])
+	}
+
+	return c
+}
+
+func (c *Colors) set(key string, sgr string) {
+	if strings.HasPrefix(key, "*") {
+		c.patterns = append(c.patterns, pattern{key, sgr})
+	} else {
+		c.kinds[key] = sgr
+	}
+}
+
+// ParseBSD reads colors in the format of BSD $LSCOLORS:
+// a foreground and a background letter for each kind of
+// file, "exfxcxdxbxegedabagacad" by default
+func ParseBSD(s string) *Colors {
+	c := &Colors{kinds: make(map[string]string)}
+
+	if len(s) < len(bsdDefault) {
+		s += bsdDefault[len(s):]
+	}
+
+	for i, key := range bsdKinds {
+		params := []string{}
+
+		if fg := bsdColor(s[2*i], 30); fg != "" {
+			params = append(params, fg)
+		}
+		if bg := bsdColor(s[2*i+1], 40); bg != "" {
+			params = append(params, bg)
+		}
+
+		c.kinds[key] = strings.Join(params, ";")
+	}
+
+	return c
+}
+
+// Converts a LSCOLORS letter to SGR parameters: a to h are
+// black, red, green, brown, blue, magenta, cyan and light
+// grey, A to H their bold variants, x the default color
+func bsdColor(letter byte, base int) string {
+	switch {
+	case letter >= 'a' && letter <= 'h':
+		return strconv.Itoa(base + int(letter-'a'))
+	case letter >= 'A' && letter <= 'H':
+		if base == 30 {
+			return "01;" + strconv.Itoa(base+int(letter-'A'))
+		}
+		return strconv.Itoa(base + int(letter-'A'))
+	}
+
+	return ""
+}
+
+// Enabled returns true when files of the kind 'key' are colored
+func (c *Colors) Enabled(key string) bool {
+	sgr := c.kinds[key]
+
+	return sgr != "" && strings.Trim(sgr, "0") != ""
+}
+
+// Style returns the SGR parameters of the name of
+// a file, empty when it is not colored
+//
+// Like GNU ls, the special permissions (su, sg, ca, ex)
+// of regular files come before their name patterns, and
+// symlinks are colored like their target with "ln=target"
+func (c *Colors) Style(e Entry) string {
+	mode := e.Mode
+	name := e.Name
+
+	if mode&os.ModeSymlink != 0 {
+		if e.Orphan && c.Enabled("or") {
+			return c.kinds["or"]
+		}
+
+		if c.kinds["ln"] != "target" {
+			return c.kinds["ln"]
+		}
+
+		if e.Orphan {
+			return ""
+		}
+
+		mode = e.TargetMode
+		name = path.Base(e.Target)
+	}
+
+	key := c.kind(e, mode)
+	if key == "fi" {
+		if sgr, ok := c.match(name); ok {
+			return sgr
+		}
+	}
+
+	if !c.Enabled(key) {
+		if key == "fi" {
+			return c.kinds["no"]
+		}
+		return ""
+	}
+
+	return c.kinds[key]
+}
+
+// Returns the key of the kind of a file of mode 'mode'
+func (c *Colors) kind(e Entry, mode os.FileMode) string {
+	otherWritable := mode.Perm()&0002 != 0
+	sticky := mode&os.ModeSticky != 0
+
+	switch {
+	case mode.IsDir():
+		switch {
+		case sticky && otherWritable && c.Enabled("tw"):
+			return "tw"
+		case otherWritable && c.Enabled("ow"):
+			return "ow"
+		case sticky && c.Enabled("st"):
+			return "st"
+		}
+		return "di"
+
+	case mode&os.ModeSymlink != 0:
+		return "ln"
+	case mode&os.ModeNamedPipe != 0:
+		return "pi"
+	case mode&os.ModeSocket != 0:
+		return "so"
+	case mode&os.ModeCharDevice != 0:
+		return "cd"
+	case mode&os.ModeDevice != 0:
+		return "bd"
+	case mode&os.ModeIrregular != 0:
+		// "or" is for broken symlinks only
+		return "fi"
+	}
+
+	switch {
+	case mode&os.ModeSetuid != 0 && c.Enabled("su"):
+		return "su"
+	case mode&os.ModeSetgid != 0 && c.Enabled("sg"):
+		return "sg"
+	case e.Capable && c.Enabled("ca"):
+		return "ca"
+	case mode.Perm()&0111 != 0 && c.Enabled("ex"):
+		return "ex"
+	case e.Links > 1 && c.Enabled("mh"):
+		return "mh"
+	}
+
+	return "fi"
+}
+
+// Returns the SGR parameters of the last pattern matching 'name',
+// comparing suffixes ("*.go") case sensitively first
+func (c *Colors) match(name string) (string, bool) {
+	for _, fold := range []bool{false, true} {
+		for i := len(c.patterns) - 1; i >= 0; i-- {
+			p := c.patterns[i]
+
+			if matches(p.glob, name, fold) {
+				return p.sgr, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func matches(glob string, name string, fold bool) bool {
+	if fold {
+		glob, name = strings.ToLower(glob), strings.ToLower(name)
+	}
+
+	suffix := glob[1:]
+	if !strings.ContainsAny(suffix, "*?[\\") {
+		return strings.HasSuffix(name, suffix)
+	}
+
+	ok, _ := path.Match(glob, name)
+
+	return ok
+}
+
+// Missing returns the SGR parameters of the
+// targets of symlinks that don't exist
+func (c *Colors) Missing() string {
+	if c.Enabled("mi") {
+		return c.kinds["mi"]
+	}
+
+	return c.kinds["or"]
+}
+
+// Paint wraps 'text' in the escape sequences of
+// the SGR parameters 'sgr', if any
+func Paint(sgr string, text string) string {
+	if sgr == "" {
+		return text
+	}
+
+	return "\x1b[" + sgr + "m" + text + "\x1b[0m"
+}
@@ -0,0 +1,114 @@
+package lscolors
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	c := Parse("di=01;31:ln=target:ex=:or=31;01:mi=05:*.go=33:*.GO=34:*.tar.gz=35:*README=36:mh=44:ca=30;41")
+
+	tests := []struct {
+		name  string
+		entry Entry
+		want  string
+	}{
+		{"directory", Entry{Name: "src", Mode: os.ModeDir | 0o755}, "01;31"},
+		{"file", Entry{Name: "notes", Mode: 0o644}, ""},
+		{"pattern", Entry{Name: "main.go", Mode: 0o644}, "33"},
+		{"pattern case", Entry{Name: "MAIN.GO", Mode: 0o644}, "34"},
+		{"pattern fold, last one", Entry{Name: "main.Go", Mode: 0o644}, "34"},
+		{"longer suffix", Entry{Name: "a.tar.gz", Mode: 0o644}, "35"},
+		{"whole name", Entry{Name: "README", Mode: 0o644}, "36"},
+		{"ex disabled", Entry{Name: "run", Mode: 0o755}, ""},
+		{"pattern before ex", Entry{Name: "run.go", Mode: 0o755}, "33"},
+		{"default setuid", Entry{Name: "su", Mode: os.ModeSetuid | 0o755}, "37;41"},
+		{"capability", Entry{Name: "ping", Mode: 0o755, Capable: true}, "30;41"},
+		{"hard links", Entry{Name: "linked", Mode: 0o644, Links: 2}, "44"},
+		{"default pipe", Entry{Name: "fifo", Mode: os.ModeNamedPipe | 0o644}, "33"},
+		{"default block device", Entry{Name: "sda", Mode: os.ModeDevice | 0o660}, "01;33"},
+		{"default char device", Entry{Name: "tty", Mode: os.ModeDevice | os.ModeCharDevice | 0o660}, "01;33"},
+		{"irregular", Entry{Name: "odd", Mode: os.ModeIrregular}, ""},
+		{"irregular pattern", Entry{Name: "odd.go", Mode: os.ModeIrregular}, "33"},
+		{"sticky other writable", Entry{Name: "tmp", Mode: os.ModeDir | os.ModeSticky | 0o777}, "30;42"},
+		{"other writable", Entry{Name: "pub", Mode: os.ModeDir | 0o777}, "34;42"},
+		{"sticky", Entry{Name: "st", Mode: os.ModeDir | os.ModeSticky | 0o755}, "37;44"},
+		{"link to target", Entry{Name: "l", Mode: os.ModeSymlink | 0o777, Target: "dir/x.go", TargetMode: 0o644}, "33"},
+		{"link to directory", Entry{Name: "l", Mode: os.ModeSymlink | 0o777, Target: "dir", TargetMode: os.ModeDir | 0o755}, "01;31"},
+		{"orphan", Entry{Name: "l", Mode: os.ModeSymlink | 0o777, Target: "gone", Orphan: true}, "31;01"},
+	}
+
+	for _, tt := range tests {
+		if got := c.Style(tt.entry); got != tt.want {
+			t.Errorf("%s: Style(%+v) = %q, want %q", tt.name, tt.entry, got, tt.want)
+		}
+	}
+
+	if got := c.Missing(); got != "05" {
+		t.Errorf("Missing() = %q, want %q", got, "05")
+	}
+	if c.Enabled("ex") || !c.Enabled("di") || c.Enabled("xx") {
+		t.Errorf("Enabled: ex %v, di %v, xx %v", c.Enabled("ex"), c.Enabled("di"), c.Enabled("xx"))
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	tests := []struct {
+		name   string
+		colors string
+		entry  Entry
+		want   string
+	}{
+		{"ln", "ln=01;36", Entry{Mode: os.ModeSymlink, Target: "x.go", TargetMode: 0o644}, "01;36"},
+		{"ln orphan without or", "ln=01;36:or=", Entry{Mode: os.ModeSymlink, Target: "x", Orphan: true}, "01;36"},
+		{"target orphan without or", "ln=target:or=", Entry{Mode: os.ModeSymlink, Target: "x", Orphan: true}, ""},
+		{"no", "no=07:fi=", Entry{Name: "f", Mode: 0o644}, "07"},
+		{"fi", "fi=32", Entry{Name: "f", Mode: 0o644}, "32"},
+		{"malformed fields", "di:=:*.go=33::x", Entry{Name: "a.go", Mode: 0o644}, "33"},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.colors).Style(tt.entry); got != tt.want {
+			t.Errorf("%s: %q = %q, want %q", tt.name, tt.colors, got, tt.want)
+		}
+	}
+
+	// Missing targets are colored like orphans without "mi"
+	if got := Parse("or=31").Missing(); got != "31" {
+		t.Errorf("Missing() = %q, want %q", got, "31")
+	}
+}
+
+func TestParseBSD(t *testing.T) {
+	tests := []struct {
+		colors string
+		kinds  map[string]string
+	}{
+		{bsdDefault, map[string]string{
+			"di": "34", "ln": "35", "so": "32", "pi": "33", "ex": "31",
+			"bd": "34;46", "cd": "34;43", "su": "30;41", "sg": "30;46", "tw": "30;42", "ow": "30;43",
+		}},
+		{"Gx", map[string]string{"di": "01;36", "ln": "35", "ow": "30;43"}},
+		{"xxHb", map[string]string{"di": "", "ln": "01;37;41"}},
+		{"ExGxFxdaCxDxEgedabagacad", map[string]string{"di": "01;34", "ln": "01;36", "pi": "33;40"}},
+		{"?!", map[string]string{"di": ""}},
+	}
+
+	for _, tt := range tests {
+		c := ParseBSD(tt.colors)
+
+		for key, want := range tt.kinds {
+			if got := c.kinds[key]; got != want {
+				t.Errorf("ParseBSD(%q): %s = %q, want %q", tt.colors, key, got, want)
+			}
+		}
+	}
+
+	c := ParseBSD(bsdDefault)
+	if got := c.Style(Entry{Name: "a.go", Mode: 0o644}); got != "" {
+		t.Errorf("files are colored %q, want no color", got)
+	}
+	if got := c.Style(Entry{Name: "run", Mode: 0o755}); got != "31" {
+		t.Errorf("executables are colored %q, want %q", got, "31")
+	}
+}
@@ -1,26 +1,229 @@
 package numfmt
 
 import (
-	"os/exec"
+	"fmt"
+	"math/bits"
+	"strconv"
 	"strings"
 )
 
-// Formats size in human readable format
-// if the -H flag is set
-// uses SI if the --si flag is set
-func NumFmt(num string, si bool) string {
-	flag := "--to=iec"
-	result := num
+// Options of Format
+type Options struct {
+	// Scale sizes to the largest unit they fit in
+	Human bool
+	// Use powers of 1000 instead of 1024
+	SI bool
+	// Decimals of human readable sizes, -1 for one
+	// decimal below 10 and none above, like numfmt
+	Precision int
+	// When not 0, sizes are divided by BlockSize, rounded
+	// up, and followed by BlockSuffix
+	BlockSize   uint64
+	BlockSuffix string
+	// Group the digits of sizes that are not
+	// human readable by thousands
+	Thousands bool
+}
+
+var units = []string{"K", "M", "G", "T", "P", "E"}
+
+// Formats a size according to 'opts'
+//
+// Human readable sizes are rounded up, like
+// `numfmt --to=iec` and `numfmt --to=si` do
+func Format(size int64, opts Options) string {
+	if size < 0 {
+		return "-" + Format(-size, opts)
+	}
 
-	if si {
-		flag = "--to=si"
+	if opts.Human {
+		return human(uint64(size), opts)
 	}
 
-	out, err := exec.Command("numfmt", flag, num).Output()
+	if opts.BlockSize > 1 {
+		blocks := uint64(size) / opts.BlockSize
+		if uint64(size)%opts.BlockSize != 0 {
+			blocks++
+		}
+
+		return group(blocks, opts.Thousands) + opts.BlockSuffix
+	}
+
+	return group(uint64(size), opts.Thousands) + opts.BlockSuffix
+}
 
-	if err == nil {
-		result = strings.Trim(string(out), " \n\r")
+// Scales a size to the largest unit it fits in
+func human(size uint64, opts Options) string {
+	var base uint64 = 1024
+	if opts.SI {
+		base = 1000
+	}
+
+	// Bytes only have the decimals asked for
+	if size < base {
+		decimals := max(opts.Precision, 0)
+
+		return fixed(size*pow10(decimals), decimals)
+	}
+
+	unit := base
+	exponent := 0
+	for exponent < len(units)-1 && size/unit >= base {
+		unit *= base
+		exponent++
+	}
+
+	for {
+		decimals := opts.Precision
+		if decimals < 0 {
+			// One decimal, unless the rounded value reaches 10
+			decimals = 1
+			if scaled := ceilDiv(size, unit, 1); scaled >= 100 {
+				decimals = 0
+			}
+		}
+
+		scaled := ceilDiv(size, unit, decimals)
+
+		// Rounding up reached the next unit (1023.9K -> 1.0M)
+		if scaled >= base*pow10(decimals) && exponent < len(units)-1 {
+			unit *= base
+			exponent++
+			continue
+		}
+
+		return fixed(scaled, decimals) + units[exponent]
+	}
+}
+
+// Returns size * 10^decimals / unit, rounded up
+func ceilDiv(size uint64, unit uint64, decimals int) uint64 {
+	hi, lo := bits.Mul64(size, pow10(decimals))
+	quotient, remainder := bits.Div64(hi, lo, unit)
+
+	if remainder != 0 {
+		quotient++
+	}
+
+	return quotient
+}
+
+func pow10(n int) uint64 {
+	var result uint64 = 1
+	for i := 0; i < n; i++ {
+		result *= 10
 	}
 
 	return result
 }
+
+// Formats a number of 10^-decimals units
+func fixed(scaled uint64, decimals int) string {
+	if decimals == 0 {
+		return strconv.FormatUint(scaled, 10)
+	}
+
+	p := pow10(decimals)
+
+	return fmt.Sprintf("%d.%0*d", scaled/p, decimals, scaled%p)
+}
+
+// Groups the digits of a number by thousands
+func group(n uint64, thousands bool) string {
+	digits := strconv.FormatUint(n, 10)
+	if !thousands {
+		return digits
+	}
+
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+
+	return b.String()
+}
+
+// ParseBlockSize parses a block size the way GNU ls does:
+// an integer, a unit (K, M, G… for powers of 1024, KB, MB…
+// for powers of 1000, KiB, MiB… for powers of 1024, "k"
+// standing for "K"), or an integer followed by a unit.
+// A leading "'" groups digits by thousands
+//
+// Sizes given as a unit alone are printed with the unit,
+// "kB" for kilobytes
+func ParseBlockSize(s string) (Options, error) {
+	opts := Options{}
+
+	s, opts.Thousands = strings.CutPrefix(s, "'")
+	if s == "" {
+		return opts, fmt.Errorf("invalid block size %q", s)
+	}
+
+	number := strings.TrimRightFunc(s, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	suffix := s[len(number):]
+	if k, ok := strings.CutPrefix(suffix, "k"); ok {
+		suffix = "K" + k
+	}
+
+	var size uint64 = 1
+	if number != "" {
+		n, err := strconv.ParseUint(number, 10, 64)
+		if err != nil || n == 0 {
+			return opts, fmt.Errorf("invalid block size %q", s)
+		}
+		size = n
+	}
+
+	if suffix != "" {
+		multiplier, ok := unitSize(suffix)
+		if !ok {
+			return opts, fmt.Errorf("invalid block size %q", s)
+		}
+
+		hi, lo := bits.Mul64(size, multiplier)
+		if hi != 0 {
+			return opts, fmt.Errorf("block size %q is too large", s)
+		}
+		size = lo
+
+		if number == "" {
+			opts.BlockSuffix = suffix
+			if suffix == "KB" {
+				opts.BlockSuffix = "kB"
+			}
+		}
+	}
+
+	opts.BlockSize = size
+
+	return opts, nil
+}
+
+// Returns the number of bytes of a unit
+// "K", "KB" or "KiB" (and M, G, T, P, E)
+func unitSize(unit string) (uint64, bool) {
+	for i, u := range units {
+		var base uint64 = 1024
+		switch unit {
+		case u, u + "iB":
+		case u + "B":
+			base = 1000
+		default:
+			continue
+		}
+
+		size := base
+		for j := 0; j < i; j++ {
+			size *= base
+		}
+
+		return size, true
+	}
+
+	return 0, false
+}
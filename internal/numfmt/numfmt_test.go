@@ -0,0 +1,179 @@
+package numfmt
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Sizes around the unit boundaries, where rounding up
+// reaches 10 and the next unit
+var sizes = []int64{
+	0, 1, 999, 1000, 1001, 1023, 1024, 1025,
+	9999, 10000, 10239, 10240, 10241, 99999, 102400, 999499, 999500,
+	1048575, 1048576, 1048577, 10485759, 1073741823, 1073741824,
+	1099511627776, 1125899906842624, 9223372036854775807,
+}
+
+// Runs GNU numfmt with 'args' on every size
+// Skips the test when numfmt is not installed
+func numfmt(t *testing.T, args ...string) []string {
+	t.Helper()
+
+	if _, err := exec.LookPath("numfmt"); err != nil {
+		t.Skip("numfmt is not installed")
+	}
+
+	for _, size := range sizes {
+		args = append(args, fmt.Sprint(size))
+	}
+
+	out, err := exec.Command("numfmt", args...).Output()
+	if err != nil {
+		t.Fatalf("numfmt %s: %v", strings.Join(args, " "), err)
+	}
+
+	return strings.Fields(string(out))
+}
+
+func TestFormatHuman(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		args []string
+	}{
+		{"iec", Options{Human: true, Precision: -1}, []string{"--to=iec"}},
+		{"si", Options{Human: true, SI: true, Precision: -1}, []string{"--to=si"}},
+		{"iec precision 0", Options{Human: true, Precision: 0}, []string{"--to=iec", "--format=%.0f"}},
+		{"iec precision 2", Options{Human: true, Precision: 2}, []string{"--to=iec", "--format=%.2f"}},
+		{"si precision 2", Options{Human: true, SI: true, Precision: 2}, []string{"--to=si", "--format=%.2f"}},
+	}
+
+	for _, tt := range tests {
+		want := numfmt(t, tt.args...)
+
+		for i, size := range sizes {
+			if got := Format(size, tt.opts); got != want[i] {
+				t.Errorf("%s: Format(%d) = %q, want %q", tt.name, size, got, want[i])
+			}
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		size int64
+		opts Options
+		want string
+	}{
+		{1234567, Options{}, "1234567"},
+		{1234567, Options{Thousands: true}, "1,234,567"},
+		{123, Options{Thousands: true}, "123"},
+		{-1536, Options{Human: true, Precision: -1}, "-1.5K"},
+		{1, Options{BlockSize: 1024}, "1"},
+		{1024, Options{BlockSize: 1024}, "1"},
+		{1025, Options{BlockSize: 1024}, "2"},
+		{1025, Options{BlockSize: 1024, BlockSuffix: "K"}, "2K"},
+		{1000001, Options{BlockSize: 1000, Thousands: true}, "1,001"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.size, tt.opts); got != tt.want {
+			t.Errorf("Format(%d, %+v) = %q, want %q", tt.size, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestParseBlockSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Options
+		err  bool
+	}{
+		{"1", Options{BlockSize: 1}, false},
+		{"512", Options{BlockSize: 512}, false},
+		{"K", Options{BlockSize: 1024, BlockSuffix: "K"}, false},
+		{"KiB", Options{BlockSize: 1024, BlockSuffix: "KiB"}, false},
+		{"KB", Options{BlockSize: 1000, BlockSuffix: "kB"}, false},
+		{"kB", Options{BlockSize: 1000, BlockSuffix: "kB"}, false},
+		{"k", Options{BlockSize: 1024, BlockSuffix: "K"}, false},
+		{"kiB", Options{BlockSize: 1024, BlockSuffix: "KiB"}, false},
+		{"M", Options{BlockSize: 1 << 20, BlockSuffix: "M"}, false},
+		{"GB", Options{BlockSize: 1e9, BlockSuffix: "GB"}, false},
+		{"E", Options{BlockSize: 1 << 60, BlockSuffix: "E"}, false},
+		{"4K", Options{BlockSize: 4096}, false},
+		{"2MB", Options{BlockSize: 2e6}, false},
+		{"'1", Options{BlockSize: 1, Thousands: true}, false},
+		{"'K", Options{BlockSize: 1024, BlockSuffix: "K", Thousands: true}, false},
+		{"", Options{}, true},
+		{"0", Options{}, true},
+		{"0K", Options{}, true},
+		{"X", Options{}, true},
+		{"4X", Options{}, true},
+		{"'", Options{}, true},
+		{"m", Options{}, true},
+		{"iB", Options{}, true},
+		{"1.5K", Options{}, true},
+		{"K4", Options{}, true},
+		{"-1", Options{}, true},
+		{"16E", Options{}, true},
+		{"99999999999999999999", Options{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBlockSize(tt.s)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseBlockSize(%q) = %+v, want an error", tt.s, got)
+			}
+			continue
+		}
+
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBlockSize(%q) = %+v, %v, want %+v", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatBlockSize(t *testing.T) {
+	if _, err := exec.LookPath("ls"); err != nil {
+		t.Skip("ls is not installed")
+	}
+	if err := exec.Command("ls", "--block-size=K", "-d", ".").Run(); err != nil {
+		t.Skip("ls is not GNU ls")
+	}
+
+	dir := t.TempDir()
+	files := []int64{0, 1, 999, 1000, 1001, 1023, 1024, 1025, 1234567, 1048577}
+	for _, size := range files {
+		name := filepath.Join(dir, fmt.Sprint(size))
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(name, size); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, blockSize := range []string{"1", "1000", "4K", "K", "k", "KB", "kB", "KiB", "M", "MB", "2MB"} {
+		opts, err := ParseBlockSize(blockSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, size := range files {
+			out, err := exec.Command("ls", "-l", "--block-size="+blockSize, filepath.Join(dir, fmt.Sprint(size))).Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := strings.Fields(string(out))[4]
+			if got := Format(size, opts); got != want {
+				t.Errorf("--block-size=%s: Format(%d) = %q, want %q", blockSize, size, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package stat
+
+// HasCapability returns false: macOS has no file capabilities
+func HasCapability(path string) bool {
+	return false
+}
@@ -0,0 +1,11 @@
+package stat
+
+import "syscall"
+
+// HasCapability returns true when the file at 'path' has
+// capabilities (the security.capability extended attribute)
+func HasCapability(path string) bool {
+	size, err := syscall.Getxattr(path, "security.capability", nil)
+
+	return err == nil && size > 0
+}
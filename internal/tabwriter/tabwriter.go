@@ -12,8 +12,11 @@
 package tabwriter
 
 import (
+	"bytes"
 	"io"
-	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/uniseg"
 )
 
 // ----------------------------------------------------------------------------
@@ -21,12 +24,12 @@ import (
 
 // A cell represents a segment of text terminated by tabs or line breaks.
 // The text itself is stored in a separate buffer; cell only describes the
-// segment's size in bytes, its width in runes, and whether it's an htab
+// segment's size in bytes, its width in terminal columns, and whether it's an htab
 // ('\t') terminated cell.
 //
 type cell struct {
 	size  int  // cell size in bytes
-	width int  // cell width in runes
+	width int  // cell width in terminal columns
 	htab  bool // true if the cell is terminated by an htab ('\t')
 }
 
@@ -40,9 +43,8 @@ type cell struct {
 //
 // Tab-terminated cells in contiguous lines constitute a column. The
 // Writer inserts padding as needed to make all cells in a column have
-// the same width, effectively aligning the columns. It assumes that
-// all characters have the same width, except for tabs for which a
-// tabwidth must be specified. Column cells must be tab-terminated, not
+// the same width, effectively aligning the columns. Tabs have a width
+// of tabwidth. Column cells must be tab-terminated, not
 // tab-separated: non-tab terminated trailing text at the end of a line
 // forms a cell but that cell is not part of an aligned column.
 // For instance, in this example (where | stands for a horizontal tab):
@@ -56,9 +58,10 @@ type cell struct {
 // all the way). The d and e are not in a column at all (there's no
 // terminating tab, nor would the column be contiguous).
 //
-// The Writer assumes that all Unicode code points have the same width;
-// this may not be true in some fonts or if the string contains combining
-// characters.
+// The width of text is the number of terminal columns it takes: each
+// grapheme cluster (a character and its combining marks, or an emoji
+// sequence) counts as one column, or two for East Asian wide and
+// fullwidth characters and emoji.
 //
 // If DiscardEmptyColumns is set, empty columns that are terminated
 // entirely by vertical (or "soft") tabs are discarded. Columns
@@ -69,6 +72,11 @@ type cell struct {
 // are passed through. The widths of tags and entities are
 // assumed to be zero (tags) and one (entities) for formatting purposes.
 //
+// ANSI escape sequences (ECMA-48) are passed through and have a width
+// of zero: control sequences (CSI, "\033[1;31m"), control strings such
+// as OSC hyperlinks and titles, terminated by BEL or ST ("\033\\"), and
+// two byte sequences. Tabs and line breaks end unterminated sequences.
+//
 // A segment of text may be escaped by bracketing it with Escape
 // characters. The tabwriter passes escaped text segments through
 // unchanged. In particular, it does not interpret any tabs or line
@@ -78,6 +86,10 @@ type cell struct {
 // width of the escaped text is always computed excluding the Escape
 // characters.
 //
+// The alignment and maximum width of the cells of each column can be set
+// with SetColumns. Cells wider than the maximum width of their column are
+// cut, and end with an ellipsis.
+//
 // The formfeed character acts like a newline but it also terminates
 // all columns in the current line (effectively calling Flush). Tab-
 // terminated cells in the next line start new columns. Unless found
@@ -96,14 +108,16 @@ type Writer struct {
 	padding  int
 	padbytes [8]byte
 	flags    uint
+	columns  []Column
 
 	// current state
 	buf     []byte   // collected text excluding tabs or line breaks
 	pos     int      // buffer position up to which cell.width of incomplete cell has been computed
 	cell    cell     // current incomplete cell; cell.width is up to buf[pos] excluding ignored sections
-	endChar byte     // terminating char of escaped sequence (Escape for escapes, '>', ';' for HTML tags/entities, or 0)
+	endChar byte     // terminating char of escaped sequence (Escape for escapes, '>', ';' for HTML tags/entities, '\033' for ANSI sequences, or 0)
+	ansi    int      // parsing state of the current ANSI escape sequence
 	lines   [][]cell // list of lines; each line is a list of cells
-	widths  []int    // list of column widths in runes - re-used during formatting
+	widths  []int    // list of column widths in terminal columns - re-used during formatting
 }
 
 // addLine adds a new line.
@@ -150,7 +164,7 @@ func (b *Writer) reset() {
 // - at any given time there is a (possibly empty) incomplete cell at the end
 //   (the cell starts after a tab or line break)
 // - cell.size is the number of bytes belonging to the cell so far
-// - cell.width is text width in runes of that cell from the start of the cell to
+// - cell.width is text width in terminal columns of that cell from the start of the cell to
 //   position pos; html tags and entities are excluded from this width if html
 //   filtering is enabled
 // - the sizes and widths of processed text are kept in the lines list
@@ -224,12 +238,52 @@ func (b *Writer) Init(output io.Writer, minwidth, tabwidth, padding int, padchar
 		flags &^= AlignRight
 	}
 	b.flags = flags
+	b.columns = nil
 
 	b.reset()
 
 	return b
 }
 
+// Alignment of the cells of a column.
+type Alignment int
+
+const (
+	// Aligned as set by the AlignRight flag.
+	Default Alignment = iota
+	Left
+	Right
+	Center
+)
+
+// A Column describes how the cells of a column are formatted.
+type Column struct {
+	Align Alignment
+	// Maximum width of the cells, 0 for none.
+	MaxWidth int
+}
+
+// SetColumns sets the alignments and maximum widths of the first columns,
+// the columns without one following the flags of the Writer. Cells with
+// an alignment are separated from the previous column by the padding,
+// whatever their alignment. If padchar is '\t', cells are left-aligned
+// whatever their alignment.
+//
+// SetColumns must be called after Init.
+//
+func (b *Writer) SetColumns(columns ...Column) *Writer {
+	b.columns = columns
+	return b
+}
+
+// Returns the format of column j.
+func (b *Writer) column(j int) Column {
+	if j < len(b.columns) {
+		return b.columns[j]
+	}
+	return Column{}
+}
+
 // debugging support (keep code around)
 func (b *Writer) dump() {
 	pos := 0
@@ -317,18 +371,18 @@ func (b *Writer) writeLines(pos0 int, line0, line1 int) (pos int) {
 			} else {
 				// non-empty cell
 				useTabs = false
-				if b.flags&AlignRight == 0 { // align left
-					b.write0(b.buf[pos : pos+c.size])
-					pos += c.size
-					if j < len(b.widths) {
-						b.writePadding(c.width, b.widths[j], false)
-					}
-				} else { // align right
-					if j < len(b.widths) {
-						b.writePadding(c.width, b.widths[j], false)
-					}
-					b.write0(b.buf[pos : pos+c.size])
-					pos += c.size
+				text, width := b.buf[pos:pos+c.size], c.width
+				pos += c.size
+				if limit := b.column(j).MaxWidth; limit > 0 && width > limit {
+					text, width = truncate(text, limit)
+				}
+				if j < len(b.widths) {
+					lead := b.leadingPadding(j, width, b.widths[j])
+					b.writePadding(0, lead, false)
+					b.write0(text)
+					b.writePadding(width+lead, b.widths[j], false)
+				} else {
+					b.write0(text)
 				}
 			}
 		}
@@ -346,6 +400,82 @@ func (b *Writer) writeLines(pos0 int, line0, line1 int) (pos int) {
 	return
 }
 
+// Returns the amount of padding written before a cell of width textw,
+// in column j of width cellw.
+func (b *Writer) leadingPadding(j int, textw, cellw int) int {
+	lead := 0 // align left
+	switch align := b.column(j).Align; {
+	case b.padbytes[0] == '\t':
+		// tab padding enforces left-alignment
+	case align == Left:
+		lead = b.padding
+	case align == Right, align == Default && b.flags&AlignRight != 0:
+		lead = cellw - textw
+	case align == Center:
+		lead = b.padding + (cellw-textw-b.padding)/2
+	}
+	return max(0, min(lead, cellw-textw))
+}
+
+// Returns text cut to width columns, ending with an ellipsis, and its
+// width. ANSI escape sequences are kept, so that the colors and links
+// they start still end.
+func truncate(text []byte, width int) ([]byte, int) {
+	var out []byte
+	w := 0
+	cut := false
+	room := width - runewidth.StringWidth(ellipsis)
+	for len(text) > 0 {
+		if text[0] == '\033' {
+			n := ansiLength(text)
+			out = append(out, text[:n]...)
+			text = text[n:]
+			continue
+		}
+
+		n := bytes.IndexByte(text, '\033')
+		if n < 0 {
+			n = len(text)
+		}
+		plain := text[:n]
+		text = text[n:]
+		if cut {
+			continue
+		}
+
+		g := uniseg.NewGraphemes(string(plain))
+		for g.Next() {
+			gw := runewidth.StringWidth(g.Str())
+			if w+gw > room {
+				out = append(out, ellipsis...)
+				w += runewidth.StringWidth(ellipsis)
+				cut = true
+				break
+			}
+			out = append(out, g.Str()...)
+			w += gw
+		}
+	}
+	return out, w
+}
+
+const ellipsis = "…"
+
+// Returns the length of the ANSI escape sequence text starts with.
+func ansiLength(text []byte) int {
+	state := ansiEscape
+	for i := 1; i < len(text); i++ {
+		part, last := advanceANSI(&state, text[i])
+		if !part {
+			return i
+		}
+		if last {
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
 // Format the text between line0 and line1 (excluding line1); pos
 // is the buffer position corresponding to the beginning of line0.
 // Returns the buffer position corresponding to the beginning of
@@ -382,7 +512,11 @@ func (b *Writer) format(pos0 int, line0, line1 int) (pos int) {
 			// cell exists in this column
 			c := line[column]
 			// update width
-			if w := c.width + b.padding; w > width {
+			cw := c.width
+			if limit := b.column(column).MaxWidth; limit > 0 && cw > limit {
+				cw = limit
+			}
+			if w := cw + b.padding; w > width {
 				width = w
 			}
 			// update discardable
@@ -415,9 +549,9 @@ func (b *Writer) append(text []byte) {
 	b.cell.size += len(text)
 }
 
-// Update the cell width.
+// Update the cell width, in terminal columns.
 func (b *Writer) updateWidth() {
-	b.cell.width += utf8.RuneCount(b.buf[b.pos:])
+	b.cell.width += runewidth.StringWidth(string(b.buf[b.pos:]))
 	b.pos = len(b.buf)
 }
 
@@ -440,14 +574,83 @@ func (b *Writer) startEscape(ch byte) {
 	case '&':
 		b.endChar = ';'
 	case '\033':
-		b.endChar = 'm'
+		b.endChar = '\033'
+		b.ansi = ansiEscape
+	}
+}
+
+// Parsing states of ANSI escape sequences
+const (
+	ansiEscape       = iota + 1 // after ESC
+	ansiIntermediate            // ESC followed by intermediate bytes (nF)
+	ansiCSI                     // control sequence, after ESC [
+	ansiString                  // control string (OSC, DCS, SOS, PM, APC)
+	ansiStringEscape            // ESC within a control string, ST is ESC \
+)
+
+// Advances the parsing of an ANSI escape sequence in state by one byte.
+// Returns whether ch is part of the sequence, and whether it ends it.
+//
+func advanceANSI(state *int, ch byte) (part, last bool) {
+	switch ch {
+	case '\t', '\v', '\n', '\f':
+		// don't swallow cells or lines with unterminated sequences
+		return false, true
 	}
+
+	switch *state {
+	case ansiEscape:
+		switch {
+		case ch == '[':
+			*state = ansiCSI
+		case ch == ']' || ch == 'P' || ch == 'X' || ch == '^' || ch == '_':
+			*state = ansiString
+		case ch >= 0x20 && ch <= 0x2f:
+			*state = ansiIntermediate
+		case ch >= 0x30 && ch <= 0x7e:
+			return true, true
+		default:
+			return false, true
+		}
+	case ansiIntermediate:
+		switch {
+		case ch >= 0x20 && ch <= 0x2f:
+		case ch >= 0x30 && ch <= 0x7e:
+			return true, true
+		default:
+			return false, true
+		}
+	case ansiCSI:
+		switch {
+		case ch >= 0x20 && ch <= 0x3f:
+		case ch >= 0x40 && ch <= 0x7e:
+			return true, true
+		default:
+			return false, true
+		}
+	case ansiString:
+		switch ch {
+		case '\a':
+			return true, true
+		case '\033':
+			*state = ansiStringEscape
+		}
+	case ansiStringEscape:
+		switch ch {
+		case '\\':
+			return true, true
+		case '\033':
+		default:
+			*state = ansiString
+		}
+	}
+	return true, false
 }
 
-// Terminate escaped mode. If the escaped text was an HTML tag, its width
-// is assumed to be zero for formatting purposes; if it was an HTML entity,
-// its width is assumed to be one. In all other cases, the width is the
-// unicode width of the text.
+// Terminate escaped mode. If the escaped text was an HTML tag or an ANSI
+// escape sequence, its width is assumed to be zero for formatting purposes;
+// if it was an HTML entity, its width is assumed to be one. In all other
+// cases, the width is the unicode width of the text.
 //
 func (b *Writer) endEscape() {
 	switch b.endChar {
@@ -456,7 +659,7 @@ func (b *Writer) endEscape() {
 		if b.flags&StripEscape == 0 {
 			b.cell.width -= 2 // don't count the Escape chars
 		}
-	case '>': // tag of zero width
+	case '>', '\033': // tag or ANSI sequence of zero width
 	case ';':
 		b.cell.width++ // entity, count as one rune
 	}
@@ -535,6 +738,24 @@ func (b *Writer) Write(buf []byte) (n int, err error) {
 	// split text into cells
 	n = 0
 	for i, ch := range buf {
+		if b.endChar == '\033' {
+			// inside ANSI escape sequence
+			part, last := advanceANSI(&b.ansi, ch)
+			if part && !last {
+				continue
+			}
+			j := i // ch is handled outside the sequence
+			if part {
+				j = i + 1
+			}
+			b.append(buf[n:j])
+			n = j
+			b.endEscape()
+			if part {
+				continue
+			}
+		}
+
 		if b.endChar == 0 {
 			// outside escape
 			switch ch {
@@ -0,0 +1,179 @@
+package tabwriter_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/gaelph/k/internal/tabwriter"
+	"github.com/mattn/go-runewidth"
+)
+
+type entry struct {
+	testname                    string
+	minwidth, tabwidth, padding int
+	padchar                     byte
+	flags                       uint
+	columns                     []Column
+	src, expected               string
+}
+
+var tests = []entry{
+	{
+		"ascii",
+		0, 8, 1, '.', 0, nil,
+		"a\tb\tc\naaa\tbbb\tc\n",
+		"a...b...c\naaa.bbb.c\n",
+	},
+
+	{
+		"cjk",
+		0, 8, 1, '.', 0, nil,
+		"日本\tx\na\tx\n",
+		"日本.x\na....x\n",
+	},
+
+	{
+		"emoji zwj",
+		0, 8, 1, '.', 0, nil,
+		"👩‍💻\tx\nab\tx\n",
+		"👩‍💻.x\nab.x\n",
+	},
+
+	{
+		"sgr",
+		0, 8, 1, '.', 0, nil,
+		"\033[31mred\033[0m\tx\nab\tx\n",
+		"\033[31mred\033[0m.x\nab..x\n",
+	},
+
+	{
+		"osc 8",
+		0, 8, 1, '.', 0, nil,
+		"\033]8;;file:///a\033\\link\033]8;;\033\\\tx\nab\tx\n",
+		"\033]8;;file:///a\033\\link\033]8;;\033\\.x\nab...x\n",
+	},
+
+	{
+		"align right flag",
+		0, 8, 1, '.', AlignRight, nil,
+		"a\tb\naaa\tb\n",
+		"...ab\n.aaab\n",
+	},
+
+	{
+		"align columns",
+		0, 8, 1, '.', 0, []Column{{Align: Right}, {Align: Center}, {Align: Left}},
+		"a\tb\tc\tx\naaaa\tbbbbb\tccc\tx\n",
+		"....a...b...c..x\n.aaaa.bbbbb.cccx\n",
+	},
+
+	{
+		"max width",
+		0, 8, 1, '.', 0, []Column{{MaxWidth: 4}},
+		"abcdef\tx\nab\tx\nabcd\tx\n",
+		"abc….x\nab...x\nabcd.x\n",
+	},
+
+	{
+		"max width cjk",
+		0, 8, 1, '.', 0, []Column{{MaxWidth: 4}},
+		"日本語\tx\n",
+		"日…..x\n",
+	},
+
+	{
+		"max width emoji zwj",
+		0, 8, 1, '.', 0, []Column{{MaxWidth: 3}},
+		"👩‍💻👩‍💻\tx\n",
+		"👩‍💻….x\n",
+	},
+
+	{
+		"max width sgr",
+		0, 8, 1, '.', 0, []Column{{MaxWidth: 3}},
+		"\033[31mabcdef\033[0m\tx\n",
+		"\033[31mab…\033[0m.x\n",
+	},
+
+	{
+		"max width osc 8",
+		0, 8, 1, '.', 0, []Column{{MaxWidth: 3}},
+		"\033]8;;file:///a\033\\abcdef\033]8;;\033\\\tx\n",
+		"\033]8;;file:///a\033\\ab…\033]8;;\033\\.x\n",
+	},
+
+	{
+		"max width align right",
+		0, 8, 1, '.', 0, []Column{{Align: Right, MaxWidth: 4}},
+		"abcdef\tx\nab\tx\n",
+		".abc…x\n...abx\n",
+	},
+}
+
+func write(t *testing.T, testname string, w *Writer, src string) {
+	t.Helper()
+
+	written, err := w.Write([]byte(src))
+	if err != nil {
+		t.Errorf("--- test: %s\n--- src:\n%q\n--- write error: %v\n", testname, src, err)
+	}
+	if written != len(src) {
+		t.Errorf("--- test: %s\n--- src:\n%q\n--- written = %d, len(src) = %d\n", testname, src, written, len(src))
+	}
+}
+
+func verify(t *testing.T, testname string, w *Writer, b *bytes.Buffer, src, expected string) {
+	t.Helper()
+
+	err := w.Flush()
+	if err != nil {
+		t.Errorf("--- test: %s\n--- src:\n%q\n--- flush error: %v\n", testname, src, err)
+	}
+
+	res := b.String()
+	if res != expected {
+		t.Errorf("--- test: %s\n--- src:\n%q\n--- found:\n%q\n--- expected:\n%q\n", testname, src, res, expected)
+	}
+}
+
+func check(t *testing.T, e entry) {
+	t.Helper()
+
+	var b bytes.Buffer
+	w := NewWriter(&b, e.minwidth, e.tabwidth, e.padding, e.padchar, e.flags)
+	w.SetColumns(e.columns...)
+
+	// write all at once
+	write(t, e.testname, w, e.src)
+	verify(t, e.testname, w, &b, e.src, e.expected)
+
+	// write byte-by-byte, splitting escape sequences and graphemes
+	b.Reset()
+	w.Init(&b, e.minwidth, e.tabwidth, e.padding, e.padchar, e.flags)
+	w.SetColumns(e.columns...)
+	for i := 0; i < len(e.src); i++ {
+		write(t, e.testname, w, e.src[i:i+1])
+	}
+	verify(t, e.testname, w, &b, e.src, e.expected)
+}
+
+func Test(t *testing.T) {
+	for _, e := range tests {
+		check(t, e)
+	}
+}
+
+// In East Asian locales the ellipsis takes two columns
+func TestEastAsianEllipsis(t *testing.T) {
+	defer func(eastAsian bool) {
+		runewidth.DefaultCondition.EastAsianWidth = eastAsian
+	}(runewidth.DefaultCondition.EastAsianWidth)
+	runewidth.DefaultCondition.EastAsianWidth = true
+
+	check(t, entry{
+		"max width east asian",
+		0, 8, 1, '.', 0, []Column{{MaxWidth: 4}},
+		"abcdef\tx\nab\tx\n",
+		"ab….x\nab...x\n",
+	})
+}
@@ -0,0 +1,132 @@
+package term
+
+// Querying the terminal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"golang.org/x/sys/unix"
+)
+
+var errNoAnswer = errors.New("the terminal did not report its background color")
+
+// BackgroundColor asks the controlling terminal for its
+// background color (OSC 11), waiting for an answer for at
+// most 'timeout'
+//
+// A cursor position query follows, that every terminal
+// answers, so that terminals ignoring OSC 11 don't make
+// it wait until the timeout
+func BackgroundColor(timeout time.Duration) (colorful.Color, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return colorful.Color{}, err
+	}
+	defer tty.Close()
+
+	fd := int(tty.Fd())
+
+	// Processes in the background can't use the terminal
+	group, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil || group != unix.Getpgrp() {
+		return colorful.Color{}, errNoAnswer
+	}
+
+	state, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return colorful.Color{}, err
+	}
+	defer unix.IoctlSetTermios(fd, ioctlSetTermios, state)
+
+	// Answers are read as they come, and not echoed
+	raw := *state
+	raw.Lflag &^= unix.ECHO | unix.ICANON
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return colorful.Color{}, err
+	}
+
+	if _, err := tty.WriteString("\x1b]11;?\x1b\\\x1b[6n"); err != nil {
+		return colorful.Color{}, err
+	}
+
+	answer, err := readAnswer(tty, time.Now().Add(timeout))
+	if err != nil {
+		return colorful.Color{}, err
+	}
+
+	return parseColor(answer)
+}
+
+// Reads what the terminal sends until the answer to the
+// cursor position query ("\x1b[<row>;<column>R")
+func readAnswer(tty *os.File, deadline time.Time) (string, error) {
+	fd := int(tty.Fd())
+	var answer []byte
+	buf := make([]byte, 64)
+
+	for {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return "", errNoAnswer
+		}
+
+		var fds unix.FdSet
+		fds.Set(fd)
+		tv := unix.NsecToTimeval(left.Nanoseconds())
+
+		n, err := unix.Select(fd+1, &fds, nil, nil, &tv)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			return "", errNoAnswer
+		}
+
+		n, err = tty.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		answer = append(answer, buf[:n]...)
+
+		if i := strings.LastIndex(string(answer), "\x1b["); i >= 0 && strings.HasSuffix(string(answer), "R") {
+			return string(answer[:i]), nil
+		}
+	}
+}
+
+// Parses an answer to OSC 11: "\x1b]11;rgb:RRRR/GGGG/BBBB"
+// followed by BEL or ST, with 1 to 4 hex digits per channel
+func parseColor(answer string) (colorful.Color, error) {
+	_, spec, ok := strings.Cut(answer, "rgb:")
+	if !ok {
+		return colorful.Color{}, errNoAnswer
+	}
+
+	spec = strings.TrimRight(spec, "\a\x1b\\")
+
+	channels := strings.Split(spec, "/")
+	if len(channels) != 3 {
+		return colorful.Color{}, fmt.Errorf("unexpected background color %q", spec)
+	}
+
+	values := [3]float64{}
+	for i, channel := range channels {
+		value, err := strconv.ParseUint(channel, 16, 16)
+		if err != nil || len(channel) == 0 || len(channel) > 4 {
+			return colorful.Color{}, fmt.Errorf("unexpected background color %q", spec)
+		}
+
+		values[i] = float64(value) / float64(uint64(1)<<(4*len(channel))-1)
+	}
+
+	return colorful.Color{R: values[0], G: values[1], B: values[2]}, nil
+}
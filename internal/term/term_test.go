@@ -0,0 +1,43 @@
+package term
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+func TestParseColor(t *testing.T) {
+	for _, tt := range []struct {
+		answer string
+		want   colorful.Color
+		error  bool
+	}{
+		// Terminated by BEL or ST
+		{answer: "\x1b]11;rgb:ffff/8000/0000\a", want: colorful.Color{R: 1, G: 0x8000 / 65535.0, B: 0}},
+		{answer: "\x1b]11;rgb:00/ff/80\x1b\\", want: colorful.Color{R: 0, G: 1, B: 0x80 / 255.0}},
+		{answer: "\x1b]11;rgb:f/0/f\a", want: colorful.Color{R: 1, G: 0, B: 1}},
+		{answer: "\x1b]11;rgb:fff/000/fff\a", want: colorful.Color{R: 1, G: 0, B: 1}},
+
+		{answer: "\x1b]11;rgb:ffff/ffff\a", error: true},
+		{answer: "\x1b]11;rgb:fffff/0/0\a", error: true},
+		{answer: "\x1b]11;rgb:gg/00/00\a", error: true},
+		{answer: "\x1b]11;rgb:/00/00\a", error: true},
+	} {
+		got, err := parseColor(tt.answer)
+		if tt.error {
+			if err == nil {
+				t.Errorf("parseColor(%q) = %v, want an error", tt.answer, got)
+			}
+			continue
+		}
+
+		if err != nil || got != tt.want {
+			t.Errorf("parseColor(%q) = %v, %v, want %v", tt.answer, got, err, tt.want)
+		}
+	}
+
+	if _, err := parseColor("\x1b[?1;2c"); !errors.Is(err, errNoAnswer) {
+		t.Errorf("parseColor without a color = %v, want errNoAnswer", err)
+	}
+}